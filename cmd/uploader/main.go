@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/aliebadimehr/telegram-uploader-bot/internal/bot"
 )
@@ -17,15 +22,110 @@ func main() {
 		configPath = env
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(ctx, configPath, os.Args[2:])
+			return
+		case "healthcheck":
+			runHealthcheck(configPath, os.Args[2:])
+			return
+		}
+	}
+
 	uploader, err := bot.New(configPath)
 	if err != nil {
 		log.Fatalf("failed to initialize bot: %v", err)
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			uploader.ReloadConfig()
+		}
+	}()
 
 	if err := uploader.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		log.Fatalf("bot stopped: %v", err)
 	}
 }
+
+func runMigrate(ctx context.Context, configPath string, args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	oldToken := fs.String("old-token", "", "token of the bot that uploaded the files (defaults to api_token from config)")
+	newToken := fs.String("new-token", "", "token of the bot that should take over the files")
+	channel := fs.String("channel", "", "storage channel (@username or numeric ID) where both bots are admins")
+	delay := fs.Duration("delay", 3*time.Second, "pause between files to stay under channel posting limits")
+	fs.Parse(args)
+
+	cfg, err := bot.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	if *oldToken == "" {
+		*oldToken = cfg.APIToken
+	}
+
+	logger, _, err := bot.NewLogger(cfg)
+	if err != nil {
+		log.Fatalf("logger: %v", err)
+	}
+	report, err := bot.Migrate(ctx, cfg, bot.MigrateOptions{
+		OldToken:       *oldToken,
+		NewToken:       *newToken,
+		StorageChannel: *channel,
+		Delay:          *delay,
+	}, logger)
+	if report != nil {
+		logger.Info("migration finished", "migrated", report.Migrated, "skipped", report.Skipped, "failed", len(report.Failures))
+		for _, failure := range report.Failures {
+			logger.Error("migration failed", "file_key", failure.FileKey, "err", failure.Err)
+		}
+	}
+	if err != nil {
+		log.Fatalf("migration stopped: %v", err)
+	}
+	if report != nil && len(report.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+// runHealthcheck probes the running bot's HTTP endpoint and exits non-zero
+// when it is unhealthy, for use as a Docker HEALTHCHECK.
+func runHealthcheck(configPath string, args []string) {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	target := fs.String("url", "", "endpoint to probe (defaults to /readyz on http_addr from config)")
+	timeout := fs.Duration("timeout", 5*time.Second, "request timeout")
+	fs.Parse(args)
+
+	if *target == "" {
+		addr := ":9090"
+		if cfg, err := bot.LoadConfig(configPath); err == nil && cfg.HTTPAddr != "" {
+			addr = cfg.HTTPAddr
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			log.Fatalf("http_addr %q: %v", addr, err)
+		}
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		*target = "http://" + net.JoinHostPort(host, port) + "/readyz"
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(*target)
+	if err != nil {
+		log.Fatalf("healthcheck: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	os.Stdout.Write(body)
+	if resp.StatusCode != http.StatusOK {
+		os.Exit(1)
+	}
+}
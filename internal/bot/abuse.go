@@ -0,0 +1,280 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// lookupWindow is how long /start lookups are counted when judging a user's
+// not-found ratio.
+const lookupWindow = 10 * time.Minute
+
+// AbuseLimits configures the temporary blocks that stop users, typically
+// scrapers guessing file keys, from flooding the bot.
+type AbuseLimits struct {
+	// RequestsPerMinute is how many updates a user may send a minute; 0
+	// disables the limit.
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	// NotFoundMin is how many links to missing files a user may open within
+	// ten minutes before NotFoundRatio is checked; 0 disables the check.
+	NotFoundMin   int     `yaml:"not_found_min"`
+	NotFoundRatio float64 `yaml:"not_found_ratio"`
+	// BlockFor is how long automatic blocks last, e.g. "1h".
+	BlockFor string `yaml:"block_for"`
+
+	blockFor time.Duration
+}
+
+func (limits *AbuseLimits) validate() error {
+	if limits.BlockFor == "" {
+		limits.BlockFor = "1h"
+	}
+	d, err := time.ParseDuration(limits.BlockFor)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("abuse.block_for: invalid duration %q", limits.BlockFor)
+	}
+	limits.blockFor = d
+	if limits.RequestsPerMinute < 0 || limits.NotFoundMin < 0 {
+		return fmt.Errorf("abuse: limits must not be negative")
+	}
+	if limits.NotFoundRatio < 0 || limits.NotFoundRatio > 1 {
+		return fmt.Errorf("abuse.not_found_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// activity counts a user's recent requests in fixed windows.
+type activity struct {
+	minute   time.Time
+	requests int
+	since    time.Time
+	lookups  int
+	misses   int
+}
+
+type abuseTracker struct {
+	mu    sync.Mutex
+	users map[int64]*activity
+	swept time.Time
+}
+
+func newAbuseTracker() *abuseTracker {
+	return &abuseTracker{users: make(map[int64]*activity), swept: time.Now()}
+}
+
+// get returns the user's counters with expired windows reset. The caller
+// holds mu.
+func (t *abuseTracker) get(userID int64, now time.Time) *activity {
+	if now.Sub(t.swept) > lookupWindow {
+		for id, a := range t.users {
+			if now.Sub(a.minute) > time.Minute && now.Sub(a.since) > lookupWindow {
+				delete(t.users, id)
+			}
+		}
+		t.swept = now
+	}
+	a, ok := t.users[userID]
+	if !ok {
+		a = &activity{minute: now, since: now}
+		t.users[userID] = a
+	}
+	if now.Sub(a.minute) > time.Minute {
+		a.minute, a.requests = now, 0
+	}
+	if now.Sub(a.since) > lookupWindow {
+		a.since, a.lookups, a.misses = now, 0, 0
+	}
+	return a
+}
+
+// request counts an update and reports whether the user went over limit.
+func (t *abuseTracker) request(userID int64, limit int) bool {
+	if limit == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a := t.get(userID, time.Now())
+	a.requests++
+	return a.requests > limit
+}
+
+// lookup counts a /start lookup and reports whether the user's misses went
+// over the limits.
+func (t *abuseTracker) lookup(userID int64, found bool, limits AbuseLimits) bool {
+	if limits.NotFoundMin == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a := t.get(userID, time.Now())
+	a.lookups++
+	if found {
+		return false
+	}
+	a.misses++
+	return a.misses >= limits.NotFoundMin && float64(a.misses)/float64(a.lookups) >= limits.NotFoundRatio
+}
+
+// forget clears a user's counters so an unbanned user starts afresh.
+func (t *abuseTracker) forget(userID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.users, userID)
+}
+
+// dropUpdate reports whether an update should be ignored without a reply:
+// its sender is banned, or has just been blocked for sending too many.
+// Admins are never dropped.
+func (b *Bot) dropUpdate(ctx context.Context, update tgbotapi.Update) bool {
+	user := update.SentFrom()
+	if user == nil || b.isAdmin(user.ID) {
+		return false
+	}
+	ban, err := b.banRepo.Active(user.ID)
+	if err != nil {
+		b.logger.WarnContext(ctx, "check ban", "err", err)
+		return false
+	}
+	if ban != nil {
+		droppedUpdatesTotal.WithLabelValues("banned").Inc()
+		return true
+	}
+	if b.abuse.request(user.ID, b.getConfig().Abuse.RequestsPerMinute) {
+		droppedUpdatesTotal.WithLabelValues("flood").Inc()
+		b.autoBan(ctx, user, "flood")
+		return true
+	}
+	return false
+}
+
+// recordLookup counts a /start lookup and blocks users who mostly open links
+// to missing files.
+func (b *Bot) recordLookup(ctx context.Context, user *tgbotapi.User, found bool) {
+	if b.isAdmin(user.ID) {
+		return
+	}
+	if b.abuse.lookup(user.ID, found, b.getConfig().Abuse) {
+		b.autoBan(ctx, user, "not_found")
+	}
+}
+
+func (b *Bot) autoBan(ctx context.Context, user *tgbotapi.User, reason string) {
+	blockFor := b.getConfig().Abuse.blockFor
+	err := b.banRepo.Ban(repository.Ban{
+		UserID: user.ID,
+		Reason: reason,
+		Until:  time.Now().Add(blockFor),
+	})
+	if err != nil {
+		b.logger.ErrorContext(ctx, "auto ban", "reason", reason, "err", err)
+		return
+	}
+	b.abuse.forget(user.ID)
+	autoBansTotal.WithLabelValues(reason).Inc()
+	b.logger.WarnContext(ctx, "user blocked automatically", "reason", reason, "for", blockFor)
+	b.reply(user.ID, b.userLocale(user).Text("auto_banned", minutesLeft(blockFor)))
+}
+
+func (b *Bot) handleBan(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) == 0 {
+		b.reply(message.Chat.ID, loc.Text("ban_usage"))
+		return
+	}
+	userID, ok := b.resolveUserID(ctx, message, args[0])
+	if !ok {
+		return
+	}
+	if b.isAdmin(userID) {
+		b.reply(message.Chat.ID, loc.Text("ban_admin"))
+		return
+	}
+	ban := repository.Ban{UserID: userID, BannedBy: message.From.ID}
+	rest := args[1:]
+	if len(rest) > 0 {
+		if d, err := time.ParseDuration(rest[0]); err == nil && d > 0 {
+			ban.Until = time.Now().Add(d)
+			rest = rest[1:]
+		}
+	}
+	ban.Reason = strings.Join(rest, " ")
+	if err := b.banRepo.Ban(ban); err != nil {
+		b.logger.ErrorContext(ctx, "ban user", "user_id", userID, "err", err)
+		b.reply(message.Chat.ID, loc.Text("ban_failed"))
+		return
+	}
+	b.logger.InfoContext(ctx, "user banned", "banned_user", userID, "until", ban.Until, "reason", ban.Reason)
+	if ban.Until.IsZero() {
+		b.reply(message.Chat.ID, loc.Text("ban_done", userID))
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("ban_done_until", userID, ban.Until.UTC().Format("2006-01-02 15:04 MST")))
+}
+
+func (b *Bot) handleUnban(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message.Chat.ID, loc.Text("unban_usage"))
+		return
+	}
+	userID, ok := b.resolveUserID(ctx, message, args[0])
+	if !ok {
+		return
+	}
+	lifted, err := b.banRepo.Unban(userID)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "unban user", "user_id", userID, "err", err)
+		b.reply(message.Chat.ID, loc.Text("ban_failed"))
+		return
+	}
+	if !lifted {
+		b.reply(message.Chat.ID, loc.Text("unban_not_banned", userID))
+		return
+	}
+	b.abuse.forget(userID)
+	b.logger.InfoContext(ctx, "user unbanned", "banned_user", userID)
+	b.reply(message.Chat.ID, loc.Text("unban_done", userID))
+}
+
+// resolveUserID turns a numeric ID or @username into a user ID, replying
+// to the admin when the username is unknown.
+func (b *Bot) resolveUserID(ctx context.Context, message *tgbotapi.Message, query string) (int64, bool) {
+	if id, err := strconv.ParseInt(query, 10, 64); err == nil {
+		return id, true
+	}
+	loc := b.userLocale(message.From)
+	user, err := b.userRepo.FindByUsername(query)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "look up user", "query", query, "err", err)
+		b.reply(message.Chat.ID, loc.Text("user_failed"))
+		return 0, false
+	}
+	if user == nil {
+		b.reply(message.Chat.ID, loc.Text("user_not_found"))
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// minutesLeft rounds a wait up to whole minutes for telling users, so a
+// block never reads as over before it is.
+func minutesLeft(wait time.Duration) int {
+	return int(math.Ceil(wait.Minutes()))
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAbuseTrackerWindows(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name         string
+		after        time.Duration
+		wantRequests int
+		wantLookups  int
+	}{
+		{"same minute keeps requests", 59 * time.Second, 2, 2},
+		{"next minute resets requests", 61 * time.Second, 0, 2},
+		{"lookup window keeps lookups", lookupWindow, 0, 2},
+		{"after the lookup window lookups reset", lookupWindow + time.Second, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newAbuseTracker()
+			tracker.swept = start
+			a := tracker.get(1, start)
+			a.requests, a.lookups, a.misses = 2, 2, 1
+			a = tracker.get(1, start.Add(tt.after))
+			if a.requests != tt.wantRequests || a.lookups != tt.wantLookups {
+				t.Fatalf("after %v: requests %d, lookups %d, want %d, %d", tt.after, a.requests, a.lookups, tt.wantRequests, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestAbuseTrackerSweep(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tracker := newAbuseTracker()
+	tracker.swept = start
+	tracker.get(1, start)
+	tracker.get(2, start.Add(lookupWindow))
+	tracker.get(3, start.Add(lookupWindow+time.Second))
+	if _, ok := tracker.users[1]; ok {
+		t.Fatal("idle user 1 was not swept")
+	}
+	if _, ok := tracker.users[2]; !ok {
+		t.Fatal("recent user 2 was swept")
+	}
+}
+
+func TestAbuseTrackerLookup(t *testing.T) {
+	limits := AbuseLimits{NotFoundMin: 3, NotFoundRatio: 0.5}
+	tests := []struct {
+		name   string
+		limits AbuseLimits
+		found  []bool
+		want   bool
+	}{
+		{"below the minimum", limits, []bool{false, false}, false},
+		{"minimum misses over the ratio", limits, []bool{false, false, false}, true},
+		{"misses under the ratio", limits, []bool{true, true, true, true, false, false, false}, false},
+		{"misses at the ratio", limits, []bool{true, true, true, false, false, false}, true},
+		{"found lookup never blocks", limits, []bool{false, false, false, true}, false},
+		{"check disabled", AbuseLimits{}, []bool{false, false, false, false}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newAbuseTracker()
+			var got bool
+			for _, found := range tt.found {
+				got = tracker.lookup(1, found, tt.limits)
+			}
+			if got != tt.want {
+				t.Fatalf("lookup after %v = %v, want %v", tt.found, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbuseTrackerRequest(t *testing.T) {
+	tracker := newAbuseTracker()
+	for i := 1; i <= 3; i++ {
+		if tracker.request(1, 3) {
+			t.Fatalf("request %d of 3 went over the limit", i)
+		}
+	}
+	if !tracker.request(1, 3) {
+		t.Fatal("fourth request did not go over the limit")
+	}
+	if tracker.request(2, 3) {
+		t.Fatal("another user's request went over the limit")
+	}
+	if tracker.request(1, 0) {
+		t.Fatal("disabled limit blocked a request")
+	}
+}
+
+func TestMinutesLeft(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{time.Second, 1},
+		{time.Minute, 1},
+		{time.Minute + time.Second, 2},
+		{15 * time.Minute, 15},
+		{time.Hour - time.Millisecond, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wait.String(), func(t *testing.T) {
+			if got := minutesLeft(tt.wait); got != tt.want {
+				t.Fatalf("minutesLeft(%v) = %d, want %d", tt.wait, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbuseLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		limits       AbuseLimits
+		wantBlockFor time.Duration
+		wantErr      bool
+	}{
+		{"default block", AbuseLimits{}, time.Hour, false},
+		{"custom block", AbuseLimits{BlockFor: "90s"}, 90 * time.Second, false},
+		{"bad duration", AbuseLimits{BlockFor: "soon"}, 0, true},
+		{"zero duration", AbuseLimits{BlockFor: "0s"}, 0, true},
+		{"negative limit", AbuseLimits{RequestsPerMinute: -1}, 0, true},
+		{"ratio over one", AbuseLimits{NotFoundRatio: 1.5}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := tt.limits
+			err := limits.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && limits.blockFor != tt.wantBlockFor {
+				t.Fatalf("blockFor = %v, want %v", limits.blockFor, tt.wantBlockFor)
+			}
+		})
+	}
+}
@@ -3,13 +3,16 @@ package bot
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"html"
+	"io/fs"
+	"log/slog"
 	"os"
-	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aliebadimehr/telegram-uploader-bot/internal/link"
@@ -19,36 +22,50 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-var (
-	mentionRe = regexp.MustCompile(`@\w+`)
-
-	guideShort   = "Use the buttons below to see how to upload files or how to get the download link."
-	guideUpload  = "📤 *How to upload & get link*\n\n1. Send me a *video*, *document*, or *photo* (as a file).\n2. Optionally add a caption (e.g. @username).\n3. I will reply with a *link* (e.g. https://t.me/YourBot?start=xxx).\n4. Share that link with anyone; when they open it, they get the file (after joining your channels if required).\n\nAuthenticate first with `/login <password>` (the password is stored in the bot config)."
-	guideGetLink = "🔗 *How to get the file from a link*\n\n1. Open the link you received (e.g. https://t.me/YourBot?start=xxx).\n2. If asked, join the required channels using the buttons, then press Start again or open the link again.\n3. The bot will send you the file. Videos are deleted after a short time; save them if needed."
-)
-
 type Config struct {
-	APIToken          string   `yaml:"api_token"`
-	BotUsername       string   `yaml:"bot_username"`
-	DefaultTag        string   `yaml:"default_tag"`
-	AdminPassword     string   `yaml:"admin_password"`
-	DeleteDelay       int      `yaml:"delete_delay"`
-	DBHost            string   `yaml:"db_host"`
-	DBPort            int      `yaml:"db_port"`
-	DBUser            string   `yaml:"db_user"`
-	DBPassword        string   `yaml:"db_password"`
-	DBName            string   `yaml:"db_name"`
-	DBSSLMode         string   `yaml:"db_sslmode"`
-	SponsoredChannels []string `yaml:"sponsored_channels"`
+	APIToken          string       `yaml:"api_token"`
+	BotUsername       string       `yaml:"bot_username"`
+	DefaultTag        string       `yaml:"default_tag"`
+	AdminPassword     string       `yaml:"admin_password"`
+	LinkSecret        string       `yaml:"link_secret"`
+	SignedLinksOnly   bool         `yaml:"signed_links_only"`
+	DeleteDelay       int          `yaml:"delete_delay"`
+	DBHost            string       `yaml:"db_host"`
+	DBPort            int          `yaml:"db_port"`
+	DBUser            string       `yaml:"db_user"`
+	DBPassword        string       `yaml:"db_password"`
+	DBName            string       `yaml:"db_name"`
+	DBSSLMode         string       `yaml:"db_sslmode"`
+	SponsoredChannels []string     `yaml:"sponsored_channels"`
+	ShowPreview       bool         `yaml:"show_preview"`
+	CaptionTemplate   string       `yaml:"caption_template"`
+	CaptionTemplateAt string       `yaml:"caption_template_at"`
+	CaptionRules      CaptionRules `yaml:"caption_rules"`
+	DefaultLanguage   string       `yaml:"default_language"`
+	LocalesDir        string       `yaml:"locales_dir"`
+	LogLevel          string       `yaml:"log_level"`
+	LogFormat         string       `yaml:"log_format"`
+	HTTPAddr          string       `yaml:"http_addr"`
+	BroadcastRate     int          `yaml:"broadcast_rate"`
+	Abuse             AbuseLimits  `yaml:"abuse"`
 }
 
+// LoadConfig reads the YAML file at path and applies UPLOADER_* environment
+// overrides on top. The file may be missing when the environment provides
+// the configuration.
 func LoadConfig(path string) (*Config, error) {
+	var cfg Config
 	raw, err := os.ReadFile(path)
-	if err != nil {
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, fs.ErrNotExist) && hasEnvConfig():
+	default:
 		return nil, err
 	}
-	var cfg Config
-	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+	if err := cfg.applyEnv(); err != nil {
 		return nil, err
 	}
 
@@ -63,8 +80,33 @@ func LoadConfig(path string) (*Config, error) {
 		}
 	}
 	cfg.SponsoredChannels = cleanedSponsors
-	if len(cfg.SponsoredChannels) == 0 || cfg.BotUsername == "" || cfg.APIToken == "" || cfg.AdminPassword == "" {
-		return nil, errors.New("config missing required fields (api_token, bot_username, sponsored_channels, admin_password)")
+	if cfg.BotUsername == "" || cfg.APIToken == "" || cfg.AdminPassword == "" {
+		return nil, errors.New("config missing required fields (api_token, bot_username, admin_password)")
+	}
+	if cfg.DefaultLanguage == "" {
+		cfg.DefaultLanguage = "fa"
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "text"
+	}
+	if cfg.BroadcastRate <= 0 {
+		cfg.BroadcastRate = 20
+	}
+	if cfg.SignedLinksOnly && cfg.LinkSecret == "" {
+		return nil, errors.New("signed_links_only needs link_secret")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("log_level: %w", err)
+	}
+	if err := cfg.CaptionRules.compile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Abuse.validate(); err != nil {
+		return nil, err
 	}
 	return &cfg, nil
 }
@@ -88,12 +130,46 @@ type Bot struct {
 	config     *Config
 	configMu   sync.RWMutex
 	api        *tgbotapi.BotAPI
-	updates    tgbotapi.UpdatesChannel
-	logger     *log.Logger
+	limiter    *rateLimiter
+	abuse      *abuseTracker
+	db         *sql.DB
+	logger     *slog.Logger
+	logLevel   *slog.LevelVar
 	linkRepo   *link.Repository
 	fileRepo   *repository.FileRepository
+	prefRepo   *repository.PreferenceRepository
+	textRepo   *repository.TextRepository
+	settings   *repository.SettingsRepository
+	userRepo   *repository.UserRepository
+	banRepo    *repository.BanRepository
+	localesMu  sync.RWMutex
+	locales    *localeSet
+	baseTexts  *localeSet
+	langMu     sync.RWMutex
+	langs      map[int64]cachedLang
+	langsSwept time.Time
 	adminMu    sync.RWMutex
 	admins     map[int64]struct{}
+	pendingMu  sync.Mutex
+	pending    map[string]*pendingUpload
+	templates  map[int64]string
+	nextKeys   map[int64]string
+	convMu     sync.Mutex
+	convs      map[int64]conversation
+	lockMu     sync.Mutex
+	pwLocks    map[int64]time.Time
+	pwFails    map[int64]passwordFailures
+	castMu     sync.Mutex
+	drafts     map[int64]*broadcastDraft
+	casting    *broadcast
+	workMu     sync.Mutex
+	workers    map[int64]*chatQueue
+	workWG     sync.WaitGroup
+	deleteMu   sync.Mutex
+	deletions  []scheduledDeletion
+	lastPoll   atomic.Int64
+	lastUpdate atomic.Int64
+	lastTick   atomic.Int64
 }
 
 func New(configPath string) (*Bot, error) {
@@ -102,88 +178,216 @@ func New(configPath string) (*Bot, error) {
 		return nil, fmt.Errorf("load config: %w", err)
 	}
 
+	logger, logLevel, err := NewLogger(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("effective config", "config", cfg.Redacted())
+
+	locales, err := loadLocales(cfg.LocalesDir, cfg.DefaultLanguage)
+	if err != nil {
+		return nil, fmt.Errorf("load locales: %w", err)
+	}
+
 	db, err := openPostgres(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("connect db: %w", err)
 	}
 
-	fmt.Println("hello")
+	logger.Info("connected to postgres", "host", cfg.DBHost, "db", cfg.DBName)
 
 	api, err := tgbotapi.NewBotAPI(cfg.APIToken)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("connect telegram: %w", redactError(err))
 	}
 	api.Debug = false
 
-	updateCfg := tgbotapi.NewUpdate(0)
-	updateCfg.Timeout = 30
-	updates := api.GetUpdatesChan(updateCfg)
+	timed := timedDB{db: db}
+	linkRepo := link.NewRepository(timed)
+	fileRepo := repository.NewFileRepository(timed)
+	settings := repository.NewSettingsRepository(timed)
 
-	linkRepo := link.NewRepository(db)
-	fileRepo := repository.NewFileRepository(db)
+	values, err := settings.All()
+	if err != nil {
+		return nil, fmt.Errorf("load settings: %w", err)
+	}
+	shadowed, err := cfg.applySettings(values)
+	if err != nil {
+		return nil, fmt.Errorf("load settings: %w", err)
+	}
+	if len(shadowed) > 0 {
+		logger.Warn("settings table overrides config", "settings", shadowed)
+	}
 
-	return &Bot{
+	uploader := &Bot{
 		configPath: configPath,
 		config:     cfg,
 		api:        api,
-		updates:    updates,
-		logger:     log.New(os.Stdout, "", log.LstdFlags),
+		db:         db,
+		logger:     logger,
+		logLevel:   logLevel,
 		linkRepo:   linkRepo,
 		fileRepo:   fileRepo,
+		prefRepo:   repository.NewPreferenceRepository(timed),
+		textRepo:   repository.NewTextRepository(timed),
+		settings:   settings,
+		userRepo:   repository.NewUserRepository(timed),
+		banRepo:    repository.NewBanRepository(timed),
+		locales:    locales,
+		baseTexts:  locales,
+		langs:      make(map[int64]cachedLang),
 		admins:     make(map[int64]struct{}),
-	}, nil
+		pending:    make(map[string]*pendingUpload),
+		templates:  make(map[int64]string),
+		nextKeys:   make(map[int64]string),
+		convs:      make(map[int64]conversation),
+		pwLocks:    make(map[int64]time.Time),
+		pwFails:    make(map[int64]passwordFailures),
+		drafts:     make(map[int64]*broadcastDraft),
+		workers:    make(map[int64]*chatQueue),
+		limiter:    newRateLimiter(),
+		abuse:      newAbuseTracker(),
+	}
+	if err := uploader.reloadTexts(); err != nil {
+		return nil, fmt.Errorf("load bot texts: %w", err)
+	}
+	return uploader, nil
 }
 
 func (b *Bot) Run(ctx context.Context) error {
-	b.logger.Printf("Bot %s ready", b.getBotUsername())
+	b.logger.Info("bot ready", "username", b.getBotUsername())
+	now := time.Now().UnixNano()
+	b.lastPoll.Store(now)
+	b.lastTick.Store(now)
+	updates := b.pollUpdates(ctx)
+	go b.runScheduler(ctx)
+	go b.watchConfig(ctx)
+	go b.watchSettings(ctx)
+	if addr := b.getConfig().HTTPAddr; addr != "" {
+		go b.serveHTTP(ctx, addr)
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			b.logger.Println("shutdown requested")
+			b.logger.Info("shutdown requested")
+			b.workWG.Wait()
 			return ctx.Err()
-		case update, ok := <-b.updates:
+		case update, ok := <-updates:
 			if !ok {
 				return errors.New("updates channel closed")
 			}
-			if update.CallbackQuery != nil {
-				b.handleCallbackQuery(update.CallbackQuery)
-				continue
-			}
-			if update.Message == nil {
-				continue
-			}
-			if update.Message.IsCommand() {
-				b.handleCommand(update.Message)
-				continue
-			}
-			if update.Message.Document != nil || update.Message.Video != nil || len(update.Message.Photo) > 0 {
-				b.handleMedia(update.Message)
-			}
+			b.lastUpdate.Store(time.Now().UnixNano())
+			b.dispatch(ctx, update)
 		}
 	}
 }
 
-func (b *Bot) handleCommand(message *tgbotapi.Message) {
-	switch message.Command() {
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	updatesTotal.WithLabelValues(updateType(update)).Inc()
+	b.touchUser(ctx, update.SentFrom())
+	if update.CallbackQuery != nil {
+		b.handleCallbackQuery(ctx, update.CallbackQuery)
+		return
+	}
+	if update.Message == nil {
+		return
+	}
+	if update.Message.IsCommand() {
+		b.logger.DebugContext(ctx, "command", "command", update.Message.Command())
+		b.handleCommand(ctx, update.Message)
+		return
+	}
+	if b.handleConversation(ctx, update.Message) {
+		return
+	}
+	if hasMedia(update.Message) {
+		b.handleMedia(ctx, update.Message)
+	}
+}
+
+func (b *Bot) handleCommand(ctx context.Context, message *tgbotapi.Message) {
+	command := message.Command()
+	start := time.Now()
+	defer func() { commandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds()) }()
+	switch command {
 	case "start":
-		b.handleStart(message)
+		b.handleStart(ctx, message)
 	case "help":
-		b.handleHelp(message)
+		b.handleHelp(ctx, message)
 	case "login":
-		b.handleLogin(message)
+		b.handleLogin(ctx, message)
 	case "logout":
-		b.handleLogout(message)
+		b.handleLogout(ctx, message)
 	case "setcaption":
-		b.handleSetCaption(message)
+		b.handleSetCaption(ctx, message)
+	case "info":
+		b.handleInfo(ctx, message)
+	case "testcaption":
+		b.handleTestCaption(ctx, message)
+	case "template":
+		b.handleTemplate(ctx, message)
+	case "settemplate":
+		b.handleSetTemplate(ctx, message)
+	case "newpost":
+		b.handleNewPost(ctx, message)
+	case "cancel":
+		b.handleCancel(ctx, message)
+	case "lang":
+		b.handleLang(ctx, message)
+	case "texts":
+		b.handleTexts(ctx, message)
+	case "text":
+		b.handleShowText(ctx, message)
+	case "settext":
+		b.handleSetText(ctx, message)
+	case "resettext":
+		b.handleResetText(ctx, message)
+	case "settings":
+		b.handleSettings(ctx, message)
+	case "channels":
+		b.handleChannels(ctx, message)
+	case "addchannel":
+		b.handleAddChannel(ctx, message)
+	case "removechannel":
+		b.handleRemoveChannel(ctx, message)
+	case "setdelay":
+		b.handleSetDelay(ctx, message)
+	case "setpreview":
+		b.handleSetPreview(ctx, message)
+	case "history":
+		b.handleHistory(ctx, message)
+	case "user":
+		b.handleUser(ctx, message)
+	case "ban":
+		b.handleBan(ctx, message)
+	case "unban":
+		b.handleUnban(ctx, message)
+	case "signlink":
+		b.handleSignLink(ctx, message)
+	case "setpassword":
+		b.handleSetPassword(ctx, message)
+	case "setkey":
+		b.handleSetKey(ctx, message)
+	case "newlink":
+		b.handleNewLink(ctx, message)
+	case "links":
+		b.handleLinks(ctx, message)
+	case "nextkey":
+		b.handleNextKey(ctx, message)
+	case "broadcast":
+		b.handleBroadcast(ctx, message)
 	case "settag":
-		b.handleConfigUpdate(message, func(cfg *Config, args []string) (string, bool, error) {
+		loc := b.userLocale(message.From)
+		b.handleConfigUpdate(ctx, message, func(cfg *Config, args []string) (string, bool, error) {
 			if len(args) != 1 || !strings.HasPrefix(args[0], "@") {
-				return "Usage: /settag @new_tag", false, nil
+				return loc.Text("settag_usage"), false, nil
 			}
 			cfg.DefaultTag = args[0]
-			return fmt.Sprintf("Default tag updated to %s", cfg.DefaultTag), true, nil
+			return loc.Text("settag_done", cfg.DefaultTag), true, nil
 		})
+	default:
+		command = "unknown"
 	}
 }
 
@@ -191,7 +395,7 @@ func (b *Bot) parseArgs(text string) []string {
 	return strings.Fields(text)
 }
 
-func (b *Bot) handleConfigUpdate(message *tgbotapi.Message, updater func(cfg *Config, args []string) (string, bool, error)) {
+func (b *Bot) handleConfigUpdate(ctx context.Context, message *tgbotapi.Message, updater func(cfg *Config, args []string) (string, bool, error)) {
 	if message.From == nil {
 		return
 	}
@@ -199,191 +403,442 @@ func (b *Bot) handleConfigUpdate(message *tgbotapi.Message, updater func(cfg *Co
 		return
 	}
 	args := b.parseArgs(message.CommandArguments())
-	response, err := b.updateConfig(func(cfg *Config) (string, bool, error) {
+	response, err := b.updateConfig(message.From.ID, func(cfg *Config) (string, bool, error) {
 		return updater(cfg, args)
 	})
 	if response != "" {
 		b.reply(message.Chat.ID, response)
 	}
 	if err != nil {
-		b.logger.Printf("failed to persist config: %v", err)
-		b.reply(message.Chat.ID, "Failed to persist config")
+		b.logger.ErrorContext(ctx, "persist config", "err", err)
+		b.reply(message.Chat.ID, b.userLocale(message.From).Text("config_persist_failed"))
 	}
 }
 
-func (b *Bot) handleStart(message *tgbotapi.Message) {
+func (b *Bot) handleStart(ctx context.Context, message *tgbotapi.Message) {
 	if message.From == nil {
 		return
 	}
+	loc := b.userLocale(message.From)
 	args := b.parseArgs(message.CommandArguments())
 	if len(args) == 0 {
-		msg := tgbotapi.NewMessage(message.Chat.ID, localization.WelcomeText+"\n\n"+guideShort)
-		msg.ReplyMarkup = b.buildGuideKeyboard()
-		if _, err := b.api.Send(msg); err != nil {
-			b.logger.Printf("failed to send start message: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, loc.Text("welcome")+"\n\n"+loc.Text("guide_short"))
+		msg.ReplyMarkup = b.buildGuideKeyboard(loc)
+		if _, err := b.send(msg); err != nil {
+			b.logger.ErrorContext(ctx, "send start message", "err", err)
 		}
 		return
 	}
-	if !b.isMember(message.From.ID) {
+	if !b.isMember(ctx, message.From.ID) {
 		keyboard := b.buildJoinKeyboard()
-		msg := tgbotapi.NewMessage(message.Chat.ID, localization.JoinText)
+		msg := tgbotapi.NewMessage(message.Chat.ID, loc.Text("join"))
 		msg.ReplyMarkup = keyboard
-		if _, err := b.api.Send(msg); err != nil {
-			b.logger.Printf("failed to send join instructions: %v", err)
+		if _, err := b.send(msg); err != nil {
+			b.logger.ErrorContext(ctx, "send join instructions", "err", err)
 		}
+		deliveriesTotal.WithLabelValues("unknown", "join_required").Inc()
 		return
 	}
 
-	fileKey := args[0]
-	record, err := b.getFile(fileKey)
+	fileKey, ok := b.startKey(ctx, message, args[0])
+	if !ok {
+		return
+	}
+	ctx = withLogAttrs(ctx, "file_key", fileKey)
+	record, source, err := b.resolveKey(fileKey)
 	if err != nil {
-		b.logger.Printf("failed to fetch file key %s: %v", fileKey, err)
-		b.reply(message.Chat.ID, "مشکلی پیش آمد، لطفاً دوباره تلاش کنید.")
+		b.logger.ErrorContext(ctx, "fetch file", "err", err)
+		b.reply(message.Chat.ID, loc.Text("error_retry"))
+		deliveriesTotal.WithLabelValues("unknown", "error").Inc()
 		return
 	}
 	if record == nil {
-		b.reply(message.Chat.ID, localization.NotFoundText)
+		b.reply(message.Chat.ID, loc.Text("not_found"))
+		deliveriesTotal.WithLabelValues("unknown", "not_found").Inc()
+		b.recordLookup(ctx, message.From, false)
 		return
 	}
-	if err := b.sendFileByType(message.Chat.ID, record); err != nil {
-		b.logger.Printf("failed to send file %s: %v", fileKey, err)
+	b.recordLookup(ctx, message.From, true)
+	b.countOpen(ctx, source)
+	if record.PasswordHash != "" && !b.isAdmin(message.From.ID) {
+		b.askPassword(ctx, message, record, fileKey)
+		return
 	}
+	b.deliverFile(ctx, message.Chat.ID, record, source, loc)
 }
 
-func (b *Bot) handleMedia(message *tgbotapi.Message) {
+// deliverFile sends a requested file, preceded by its preview when enabled,
+// and credits the link it was requested through.
+func (b *Bot) deliverFile(ctx context.Context, chatID int64, record *repository.FileRecord, source *link.Link, loc Localization) {
+	if b.getConfig().ShowPreview {
+		if preview := filePreview(record); preview != "" {
+			b.reply(chatID, preview)
+		}
+	}
+	if err := b.sendFileByType(ctx, chatID, record, loc); err != nil {
+		b.logger.ErrorContext(ctx, "send file", "err", err)
+		deliveriesTotal.WithLabelValues(record.FileType, "failed").Inc()
+		return
+	}
+	deliveriesTotal.WithLabelValues(record.FileType, "sent").Inc()
+	b.countDelivery(ctx, source)
+}
+
+func (b *Bot) handleMedia(ctx context.Context, message *tgbotapi.Message) {
 	if message.From == nil || !b.isAdmin(message.From.ID) {
 		return
 	}
-	var fileID, fileType string
-	switch {
-	case message.Document != nil:
-		fileID = message.Document.FileID
-		fileType = "document"
-	case message.Video != nil:
-		fileID = message.Video.FileID
-		fileType = "video"
-	case len(message.Photo) > 0:
-		fileID = message.Photo[len(message.Photo)-1].FileID
-		fileType = "photo"
-	default:
+	record := mediaFromMessage(message)
+	if record == nil {
+		return
+	}
+	record.Caption = b.processCaption(message.Caption, message.CaptionEntities)
+	record.ParseMode = tgbotapi.ModeHTML
+	if b.offerExisting(ctx, message, record) {
+		return
+	}
+	// The /nextkey choice is only used up when the file is published, so it
+	// survives reusing an existing copy.
+	record.FileKey = b.takeNextKey(message.From.ID)
+	b.publishFile(ctx, message.Chat.ID, record, b.userLocale(message.From))
+}
+
+func (b *Bot) publishFile(ctx context.Context, chatID int64, record *repository.FileRecord, loc Localization) {
+	fileKey, err := b.addFile(record)
+	if errors.Is(err, repository.ErrKeyTaken) {
+		b.reply(chatID, loc.Text("key_taken", record.FileKey))
 		return
 	}
-	caption := b.processCaption(message.Caption)
-	fileKey, err := b.addFile(fileID, fileType, caption)
 	if err != nil {
-		b.logger.Printf("failed to save file: %v", err)
+		b.logger.ErrorContext(ctx, "save file", "err", err)
 		return
 	}
-	linkURL := fmt.Sprintf("https://t.me/%s?start=%s", strings.TrimPrefix(b.getBotUsername(), "@"), fileKey)
-	linkURL, err = fmt.Sprintf("https://t.me/%s?start=%s", strings.TrimPrefix(b.getBotUsername(), "@"), fileKey), nil
+	ctx = withLogAttrs(ctx, "file_key", fileKey)
+	if rendered := b.applyTemplate(record, templateAtUpload); rendered != record {
+		if err := b.fileRepo.UpdateCaption(fileKey, rendered.Caption, rendered.ParseMode); err != nil {
+			b.logger.ErrorContext(ctx, "apply caption template", "err", err)
+		} else {
+			record = rendered
+		}
+	}
+	linkURL := b.fileLink(fileKey)
 	if err := b.linkRepo.Save(&link.Link{
 		FileKey:   fileKey,
+		Code:      fileKey,
 		URL:       linkURL,
 		CreatedAt: time.Now().UTC(),
 	}); err != nil {
-		b.logger.Printf("failed to save link for %s: %v", fileKey, err)
+		b.logger.ErrorContext(ctx, "save link", "err", err)
+	}
+	b.reply(chatID, loc.Text("file_link_created", linkURL))
+	if record.FileType != "text" {
+		b.promptCaption(chatID, fileKey, record, loc)
+	}
+}
+
+func (b *Bot) sendFileByType(ctx context.Context, chatID int64, record *repository.FileRecord, loc Localization) error {
+	record = b.applyTemplate(record, templateAtDelivery)
+	msg, err := buildMediaConfig(chatID, record)
+	if err != nil {
+		return err
+	}
+	sent, err := b.send(msg)
+	if err != nil {
+		return err
+	}
+	if record.FileType != "video" {
+		return nil
+	}
+	delay := b.getConfig().DeleteDelay
+	warn := tgbotapi.NewMessage(chatID, loc.Text("warning", delay))
+	sentWarn, err := b.send(warn)
+	if err != nil {
+		return err
 	}
-	b.reply(message.Chat.ID, fmt.Sprintf("File link created:\n%s", linkURL))
-	b.promptCaption(message.Chat.ID, fileKey, caption)
+	messageIDs := []int{sent.MessageID, sentWarn.MessageID}
+	b.deleteMessagesLater(ctx, chatID, messageIDs, time.Duration(delay)*time.Second)
+	return nil
 }
 
-func (b *Bot) sendFileByType(chatID int64, record *repository.FileRecord) error {
+func buildMediaConfig(chatID int64, record *repository.FileRecord) (tgbotapi.Chattable, error) {
+	file := tgbotapi.FileID(record.FileID)
 	switch record.FileType {
+	case "text":
+		msg := tgbotapi.NewMessage(chatID, record.Caption)
+		msg.ParseMode = record.ParseMode
+		return msg, nil
 	case "document":
-		msg := tgbotapi.NewDocument(chatID, tgbotapi.FileID(record.FileID))
+		msg := tgbotapi.NewDocument(chatID, file)
 		msg.Caption = record.Caption
-		_, err := b.api.Send(msg)
-		return err
+		msg.ParseMode = record.ParseMode
+		return msg, nil
 	case "photo":
-		msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(record.FileID))
+		msg := tgbotapi.NewPhoto(chatID, file)
 		msg.Caption = record.Caption
-		_, err := b.api.Send(msg)
-		return err
+		msg.ParseMode = record.ParseMode
+		return msg, nil
 	case "video":
-		videoMsg := tgbotapi.NewVideo(chatID, tgbotapi.FileID(record.FileID))
-		videoMsg.Caption = record.Caption
-		sentVideo, err := b.api.Send(videoMsg)
-		if err != nil {
-			return err
+		msg := tgbotapi.NewVideo(chatID, file)
+		msg.Caption = record.Caption
+		msg.ParseMode = record.ParseMode
+		msg.Duration = record.Duration
+		return msg, nil
+	case "audio":
+		msg := tgbotapi.NewAudio(chatID, file)
+		msg.Caption = record.Caption
+		msg.ParseMode = record.ParseMode
+		msg.Duration = record.Duration
+		msg.Performer = record.Performer
+		msg.Title = record.Title
+		return msg, nil
+	case "voice":
+		msg := tgbotapi.NewVoice(chatID, file)
+		msg.Caption = record.Caption
+		msg.ParseMode = record.ParseMode
+		msg.Duration = record.Duration
+		return msg, nil
+	case "animation":
+		msg := tgbotapi.NewAnimation(chatID, file)
+		msg.Caption = record.Caption
+		msg.ParseMode = record.ParseMode
+		msg.Duration = record.Duration
+		return msg, nil
+	case "video_note":
+		// Video notes and stickers can't carry a caption.
+		msg := tgbotapi.NewVideoNote(chatID, record.Width, file)
+		msg.Duration = record.Duration
+		return msg, nil
+	case "sticker":
+		return tgbotapi.NewSticker(chatID, file), nil
+	default:
+		return nil, fmt.Errorf("unknown file type %s", record.FileType)
+	}
+}
+
+func hasMedia(message *tgbotapi.Message) bool {
+	return message.Document != nil ||
+		message.Video != nil ||
+		len(message.Photo) > 0 ||
+		message.Audio != nil ||
+		message.Voice != nil ||
+		message.Animation != nil ||
+		message.VideoNote != nil ||
+		message.Sticker != nil
+}
+
+// mediaFromMessage extracts the attached file, or returns nil when there is none.
+// Animations are checked first because Telegram also fills Document for them.
+func mediaFromMessage(message *tgbotapi.Message) *repository.FileRecord {
+	switch {
+	case message.Animation != nil:
+		m := message.Animation
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "animation",
+			Duration:     m.Duration,
+			FileUniqueID: m.FileUniqueID,
+			FileName:     m.FileName,
+			MimeType:     m.MimeType,
+			FileSize:     int64(m.FileSize),
+			Width:        m.Width,
+			Height:       m.Height,
 		}
-		warn := tgbotapi.NewMessage(chatID, localization.WarningText)
-		sentWarn, err := b.api.Send(warn)
-		if err != nil {
-			return err
+	case message.Document != nil:
+		m := message.Document
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "document",
+			FileUniqueID: m.FileUniqueID,
+			FileName:     m.FileName,
+			MimeType:     m.MimeType,
+			FileSize:     int64(m.FileSize),
+		}
+	case message.Video != nil:
+		m := message.Video
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "video",
+			Duration:     m.Duration,
+			FileUniqueID: m.FileUniqueID,
+			FileName:     m.FileName,
+			MimeType:     m.MimeType,
+			FileSize:     int64(m.FileSize),
+			Width:        m.Width,
+			Height:       m.Height,
+		}
+	case len(message.Photo) > 0:
+		m := message.Photo[len(message.Photo)-1]
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "photo",
+			FileUniqueID: m.FileUniqueID,
+			FileSize:     int64(m.FileSize),
+			Width:        m.Width,
+			Height:       m.Height,
+		}
+	case message.Audio != nil:
+		m := message.Audio
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "audio",
+			Duration:     m.Duration,
+			Performer:    m.Performer,
+			Title:        m.Title,
+			FileUniqueID: m.FileUniqueID,
+			FileName:     m.FileName,
+			MimeType:     m.MimeType,
+			FileSize:     int64(m.FileSize),
+		}
+	case message.Voice != nil:
+		m := message.Voice
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "voice",
+			Duration:     m.Duration,
+			FileUniqueID: m.FileUniqueID,
+			MimeType:     m.MimeType,
+			FileSize:     int64(m.FileSize),
+		}
+	case message.VideoNote != nil:
+		m := message.VideoNote
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "video_note",
+			Duration:     m.Duration,
+			FileUniqueID: m.FileUniqueID,
+			FileSize:     int64(m.FileSize),
+			Width:        m.Length,
+			Height:       m.Length,
+		}
+	case message.Sticker != nil:
+		m := message.Sticker
+		return &repository.FileRecord{
+			FileID:       m.FileID,
+			FileType:     "sticker",
+			FileUniqueID: m.FileUniqueID,
+			FileSize:     int64(m.FileSize),
+			Width:        m.Width,
+			Height:       m.Height,
 		}
-		messageIDs := []int{sentVideo.MessageID, sentWarn.MessageID}
-		b.deleteMessagesLater(chatID, messageIDs, time.Duration(b.getConfig().DeleteDelay)*time.Second)
-		return nil
 	default:
-		return fmt.Errorf("unknown file type %s", record.FileType)
+		return nil
+	}
+}
+
+// scheduledDeletion is a delivered message to remove once at has passed.
+type scheduledDeletion struct {
+	ctx       context.Context
+	chatID    int64
+	messageID int
+	at        time.Time
+}
+
+func (b *Bot) deleteMessagesLater(ctx context.Context, chatID int64, messageIDs []int, delay time.Duration) {
+	at := time.Now().Add(delay)
+	b.deleteMu.Lock()
+	for _, id := range messageIDs {
+		b.deletions = append(b.deletions, scheduledDeletion{ctx: ctx, chatID: chatID, messageID: id, at: at})
 	}
+	b.deleteMu.Unlock()
+	pendingDeletions.Add(float64(len(messageIDs)))
 }
 
-func (b *Bot) deleteMessagesLater(chatID int64, messageIDs []int, delay time.Duration) {
-	go func() {
-		timer := time.NewTimer(delay)
-		defer timer.Stop()
+// runScheduler deletes due messages every schedulerTick. Each pass is
+// recorded so health checks notice if the loop stops.
+func (b *Bot) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	for {
 		select {
-		case <-timer.C:
-			for _, id := range messageIDs {
-				if _, err := b.api.Request(tgbotapi.DeleteMessageConfig{
-					ChatID:    chatID,
-					MessageID: id,
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			b.lastTick.Store(now.UnixNano())
+			for _, deletion := range b.dueDeletions(now) {
+				if _, err := b.request(tgbotapi.DeleteMessageConfig{
+					ChatID:    deletion.chatID,
+					MessageID: deletion.messageID,
 				}); err != nil {
-					b.logger.Printf("delete message %d failed: %v", id, err)
+					b.logger.WarnContext(deletion.ctx, "delete message", "message_id", deletion.messageID, "err", err)
 				}
+				pendingDeletions.Dec()
 			}
 		}
-	}()
+	}
 }
 
-func (b *Bot) addFile(fileID, fileType, caption string) (string, error) {
-	if caption == "" {
-		caption = b.getConfig().DefaultTag
+func (b *Bot) dueDeletions(now time.Time) []scheduledDeletion {
+	b.deleteMu.Lock()
+	defer b.deleteMu.Unlock()
+	var due []scheduledDeletion
+	remaining := b.deletions[:0]
+	for _, deletion := range b.deletions {
+		if deletion.at.After(now) {
+			remaining = append(remaining, deletion)
+		} else {
+			due = append(due, deletion)
+		}
 	}
-	if fileType == "" {
-		fileType = "document"
+	b.deletions = remaining
+	return due
+}
+
+func (b *Bot) addFile(record *repository.FileRecord) (string, error) {
+	if record.Caption == "" {
+		record.Caption = b.getConfig().DefaultTag
+		if record.ParseMode == tgbotapi.ModeHTML {
+			record.Caption = html.EscapeString(record.Caption)
+		}
 	}
-	return b.fileRepo.Save(fileID, fileType, caption)
+	if record.FileType == "" {
+		record.FileType = "document"
+	}
+	return b.fileRepo.Save(record)
 }
 
-func (b *Bot) updateCaption(fileKey, caption string) error {
-	cleaned := b.processCaption(caption)
-	return b.fileRepo.UpdateCaption(fileKey, cleaned)
+func (b *Bot) updateCaption(fileKey, caption string, entities []tgbotapi.MessageEntity) error {
+	cleaned := b.processCaption(caption, entities)
+	return b.fileRepo.UpdateCaption(fileKey, cleaned, tgbotapi.ModeHTML)
 }
 
 func (b *Bot) getFile(fileKey string) (*repository.FileRecord, error) {
 	return b.fileRepo.Get(fileKey)
 }
 
-func (b *Bot) processCaption(caption string) string {
-	if caption == "" {
-		return b.getConfig().DefaultTag
-	}
-	cleaned := mentionRe.ReplaceAllString(caption, b.getConfig().DefaultTag)
-	if !strings.Contains(cleaned, b.getConfig().DefaultTag) {
-		return b.getConfig().DefaultTag
-	}
-	return cleaned
-}
-
-func (b *Bot) isMember(userID int64) bool {
+func (b *Bot) isMember(ctx context.Context, userID int64) bool {
 	channels := b.getConfig().SponsoredChannels
 	if len(channels) == 0 {
 		return true
 	}
 	for _, channel := range channels {
-		if !b.userHasStatus(channel, userID) {
+		if !b.userHasStatus(ctx, channel, userID) {
 			return false
 		}
 	}
 	return true
 }
 
-func (b *Bot) userHasStatus(channel string, userID int64) bool {
+func (b *Bot) userHasStatus(ctx context.Context, channel string, userID int64) bool {
+	status, err := b.chatMemberStatus(channel, userID)
+	if err != nil {
+		membershipChecksTotal.WithLabelValues(channel, "error").Inc()
+		b.logger.WarnContext(ctx, "get chat member", "channel", channel, "err", err)
+		return false
+	}
+	switch status {
+	case "member", "administrator", "creator":
+		membershipChecksTotal.WithLabelValues(channel, "hit").Inc()
+		return true
+	default:
+		membershipChecksTotal.WithLabelValues(channel, "miss").Inc()
+		return false
+	}
+}
+
+func (b *Bot) chatMemberStatus(channel string, userID int64) (string, error) {
 	normalized := normalizeChannel(channel)
 	if normalized == "" {
-		return false
+		return "", fmt.Errorf("invalid channel %q", channel)
 	}
 
 	chatConfig := tgbotapi.GetChatMemberConfig{
@@ -393,17 +848,15 @@ func (b *Bot) userHasStatus(channel string, userID int64) bool {
 			UserID:             userID,
 		},
 	}
-	member, err := b.api.GetChatMember(chatConfig)
+	resp, err := b.request(chatConfig)
 	if err != nil {
-		b.logger.Printf("get chat member %s: %v", channel, err)
-		return false
+		return "", err
 	}
-	switch member.Status {
-	case "member", "administrator", "creator":
-		return true
-	default:
-		return false
+	var member tgbotapi.ChatMember
+	if err := json.Unmarshal(resp.Result, &member); err != nil {
+		return "", err
 	}
+	return member.Status, nil
 }
 
 func normalizeChannel(channel string) string {
@@ -415,11 +868,11 @@ func normalizeChannel(channel string) string {
 	return strings.TrimSpace(channel)
 }
 
-func (b *Bot) buildGuideKeyboard() tgbotapi.InlineKeyboardMarkup {
+func (b *Bot) buildGuideKeyboard(loc Localization) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📤 How to upload", "guide_upload"),
-			tgbotapi.NewInlineKeyboardButtonData("🔗 How to get link", "guide_link"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_guide_upload"), "guide_upload"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_guide_link"), "guide_link"),
 		),
 	)
 }
@@ -449,113 +902,171 @@ func (b *Bot) buildJoinKeyboard() tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
 
-func (b *Bot) handleCallbackQuery(cq *tgbotapi.CallbackQuery) {
+func (b *Bot) handleCallbackQuery(ctx context.Context, cq *tgbotapi.CallbackQuery) {
 	if cq.Message == nil || cq.Data == "" {
 		return
 	}
 	callback := tgbotapi.NewCallback(cq.ID, "")
-	if _, err := b.api.Request(callback); err != nil {
-		b.logger.Printf("answer callback: %v", err)
+	if _, err := b.request(callback); err != nil {
+		b.logger.WarnContext(ctx, "answer callback", "err", err)
+	}
+	if strings.HasPrefix(cq.Data, duplicateCallbackPrefix) {
+		b.handleDuplicateChoice(ctx, cq)
+		return
+	}
+	if strings.HasPrefix(cq.Data, broadcastCallbackPrefix) {
+		b.handleBroadcastCallback(ctx, cq)
+		return
+	}
+	if cq.Data == templateSave || cq.Data == templateDiscard {
+		b.handleTemplateChoice(ctx, cq)
+		return
 	}
+	if strings.HasPrefix(cq.Data, langCallbackPrefix) {
+		b.handleLangCallback(ctx, cq)
+		return
+	}
+	loc := b.userLocale(cq.From)
 	var text string
 	switch cq.Data {
 	case "guide_upload":
-		text = guideUpload
+		text = loc.Text("guide_upload")
 	case "guide_link":
-		text = guideGetLink
+		text = loc.Text("guide_get_link")
 	default:
 		return
 	}
 	msg := tgbotapi.NewMessage(cq.Message.Chat.ID, text)
 	msg.ParseMode = "Markdown"
-	if _, err := b.api.Send(msg); err != nil {
-		b.logger.Printf("send guide: %v", err)
+	if _, err := b.send(msg); err != nil {
+		b.logger.ErrorContext(ctx, "send guide", "err", err)
 	}
 }
 
-func (b *Bot) handleHelp(message *tgbotapi.Message) {
+func (b *Bot) handleHelp(ctx context.Context, message *tgbotapi.Message) {
 	if message.From == nil {
 		return
 	}
-	full := guideShort + "\n\n---\n\n" + guideUpload + "\n\n---\n\n" + guideGetLink
+	loc := b.userLocale(message.From)
+	full := loc.Text("guide_short") + "\n\n---\n\n" + loc.Text("guide_upload") + "\n\n---\n\n" + loc.Text("guide_get_link")
 	msg := tgbotapi.NewMessage(message.Chat.ID, full)
 	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = b.buildGuideKeyboard()
-	if _, err := b.api.Send(msg); err != nil {
-		b.logger.Printf("send help: %v", err)
+	msg.ReplyMarkup = b.buildGuideKeyboard(loc)
+	if _, err := b.send(msg); err != nil {
+		b.logger.ErrorContext(ctx, "send help", "err", err)
 	}
 }
 
-func (b *Bot) promptCaption(chatID int64, fileKey, caption string) {
-	msg := fmt.Sprintf("Caption saved as:\n%s\nIf you'd like to change it before users open the link, send:\n/setcaption %s <new caption>", caption, fileKey)
-	b.reply(chatID, msg)
+// promptCaption shows the admin the stored caption. HTML captions are sent
+// as HTML so the admin sees the formatting rather than the tags.
+func (b *Bot) promptCaption(chatID int64, fileKey string, record *repository.FileRecord, loc Localization) {
+	plain := loc.Text("caption_prompt", record.Caption, fileKey)
+	if record.ParseMode != tgbotapi.ModeHTML {
+		b.reply(chatID, plain)
+		return
+	}
+	b.replyHTML(chatID, htmlText(loc, "caption_prompt", record.Caption, html.EscapeString(fileKey)), plain)
 }
 
-func (b *Bot) handleSetCaption(message *tgbotapi.Message) {
+func (b *Bot) handleSetCaption(ctx context.Context, message *tgbotapi.Message) {
 	if message.From == nil || !b.isAdmin(message.From.ID) {
 		return
 	}
+	loc := b.userLocale(message.From)
 	raw := strings.TrimLeft(message.CommandArguments(), " \t")
 	if raw == "" {
-		b.reply(message.Chat.ID, "Usage: /setcaption <file_key> <new caption>")
+		b.reply(message.Chat.ID, loc.Text("setcaption_usage"))
 		return
 	}
 	fields := strings.Fields(raw)
 	if len(fields) == 0 {
-		b.reply(message.Chat.ID, "Usage: /setcaption <file_key> <new caption>")
+		b.reply(message.Chat.ID, loc.Text("setcaption_usage"))
 		return
 	}
 	fileKey := fields[0]
 	caption := raw[len(fileKey):]
 	caption = strings.TrimLeft(caption, " \t")
 	if strings.TrimSpace(caption) == "" {
-		b.reply(message.Chat.ID, "Caption cannot be empty.")
+		b.reply(message.Chat.ID, loc.Text("caption_empty"))
+		return
+	}
+	ctx = withLogAttrs(ctx, "file_key", fileKey)
+	record, err := b.getFile(fileKey)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "fetch file", "err", err)
+		b.reply(message.Chat.ID, loc.Text("caption_update_failed"))
 		return
 	}
-	if err := b.updateCaption(fileKey, caption); err != nil {
-		b.logger.Printf("update caption failed for %s: %v", fileKey, err)
-		b.reply(message.Chat.ID, "Failed to update caption.")
+	if record != nil && record.FileType == "text" {
+		// A text post's body is its caption; the caption rules would
+		// replace it with the bare tag.
+		b.reply(message.Chat.ID, loc.Text("setcaption_text_post"))
 		return
 	}
-	b.reply(message.Chat.ID, fmt.Sprintf("Caption for %s updated.", fileKey))
+	caption, entities := sliceEntities(message.Text, message.Entities, len(message.Text)-len(caption))
+	if err := b.updateCaption(fileKey, caption, entities); err != nil {
+		b.logger.ErrorContext(ctx, "update caption", "err", err)
+		b.reply(message.Chat.ID, loc.Text("caption_update_failed"))
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("caption_updated", fileKey))
 }
 
-func (b *Bot) handleLogin(message *tgbotapi.Message) {
+func (b *Bot) handleLogin(ctx context.Context, message *tgbotapi.Message) {
 	if message.From == nil {
 		return
 	}
+	loc := b.userLocale(message.From)
 	args := b.parseArgs(message.CommandArguments())
 	if len(args) != 1 {
-		b.reply(message.Chat.ID, "Usage: /login <password>")
+		b.reply(message.Chat.ID, loc.Text("login_usage"))
 		return
 	}
 	if args[0] != b.getConfig().AdminPassword {
-		b.reply(message.Chat.ID, "Invalid password.")
+		b.reply(message.Chat.ID, loc.Text("login_invalid"))
 		return
 	}
 	b.setAdmin(message.From.ID, true)
-	b.reply(message.Chat.ID, "You are now authenticated as admin. You can upload videos and run admin commands.")
+	b.reply(message.Chat.ID, loc.Text("login_ok"))
 }
 
-func (b *Bot) handleLogout(message *tgbotapi.Message) {
+func (b *Bot) handleLogout(ctx context.Context, message *tgbotapi.Message) {
 	if message.From == nil {
 		return
 	}
+	loc := b.userLocale(message.From)
 	if !b.isAdmin(message.From.ID) {
-		b.reply(message.Chat.ID, "You are not logged in.")
+		b.reply(message.Chat.ID, loc.Text("logout_not_logged_in"))
 		return
 	}
 	b.setAdmin(message.From.ID, false)
-	b.reply(message.Chat.ID, "Logged out from admin mode.")
+	b.reply(message.Chat.ID, loc.Text("logout_ok"))
 }
 
 func (b *Bot) reply(chatID int64, text string) {
 	msg := tgbotapi.NewMessage(chatID, text)
-	if _, err := b.api.Send(msg); err != nil {
-		b.logger.Printf("reply failed: %v", err)
+	if _, err := b.send(msg); err != nil {
+		b.logger.Error("reply", "chat_id", chatID, "err", err)
 	}
 }
 
+// replyHTML sends text with the HTML parse mode, and fallback as plain text
+// if Telegram rejects the markup.
+func (b *Bot) replyHTML(chatID int64, text, fallback string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if _, err := b.send(msg); err != nil {
+		b.logger.Warn("reply as HTML", "chat_id", chatID, "err", err)
+		b.reply(chatID, fallback)
+	}
+}
+
+// htmlText formats a locale text whose arguments are already HTML, escaping
+// the text itself.
+func htmlText(loc Localization, key string, args ...any) string {
+	return fmt.Sprintf(html.EscapeString(loc.Text(key)), args...)
+}
+
 func (b *Bot) isAdmin(userID int64) bool {
 	b.adminMu.RLock()
 	defer b.adminMu.RUnlock()
@@ -579,29 +1090,28 @@ func (b *Bot) getConfig() *Config {
 	return b.config
 }
 
-func (b *Bot) updateConfig(updater func(cfg *Config) (string, bool, error)) (string, error) {
+// updateConfig applies updater to a copy of the current config, stores the
+// changed settings in the database and swaps the copy in, so readers holding
+// the previous *Config never see a half-applied change.
+func (b *Bot) updateConfig(userID int64, updater func(cfg *Config) (string, bool, error)) (string, error) {
 	b.configMu.Lock()
 	defer b.configMu.Unlock()
-	response, dirty, err := updater(b.config)
+	cfg := b.config.clone()
+	response, dirty, err := updater(cfg)
+	if err != nil || !dirty {
+		return response, err
+	}
+	values, err := changedSettings(b.config, cfg)
 	if err != nil {
 		return response, err
 	}
-	if dirty {
-		if err := b.persistConfig(); err != nil {
-			return response, err
-		}
+	if err := b.settings.Set(values, userID); err != nil {
+		return response, err
 	}
+	b.config = cfg
 	return response, nil
 }
 
-func (b *Bot) persistConfig() error {
-	raw, err := yaml.Marshal(b.config)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(b.configPath, raw, 0o600)
-}
-
 func initDB(db *sql.DB) error {
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS files (
@@ -615,20 +1125,154 @@ func initDB(db *sql.DB) error {
 	if err != nil {
 		return err
 	}
+	for _, stmt := range []string{
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS duration INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS performer TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS file_unique_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS file_name TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS file_size BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS width INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS height INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS parse_mode TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS files_file_unique_id_idx ON files (file_unique_id)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_preferences (
+			user_id BIGINT PRIMARY KEY,
+			language TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bot_texts (
+			lang TEXT NOT NULL,
+			key TEXT NOT NULL,
+			text TEXT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (lang, key)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			user_id BIGINT PRIMARY KEY,
+			username TEXT NOT NULL DEFAULT '',
+			first_name TEXT NOT NULL DEFAULT '',
+			last_name TEXT NOT NULL DEFAULT '',
+			language_code TEXT NOT NULL DEFAULT '',
+			first_seen TIMESTAMPTZ NOT NULL,
+			last_seen TIMESTAMPTZ NOT NULL,
+			blocked_bot BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS users_username_idx ON users (lower(username));
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS file_aliases (
+			alias TEXT PRIMARY KEY,
+			file_key TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS file_aliases_file_key_idx ON file_aliases (file_key);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bans (
+			user_id BIGINT PRIMARY KEY,
+			reason TEXT NOT NULL DEFAULT '',
+			banned_by BIGINT NOT NULL,
+			banned_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_by BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS settings_history (
+			id BIGSERIAL PRIMARY KEY,
+			key TEXT NOT NULL,
+			old_value TEXT NOT NULL,
+			new_value TEXT NOT NULL,
+			changed_by BIGINT NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS settings_version (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			version BIGINT NOT NULL
+		);
+		INSERT INTO settings_version (id, version) VALUES (TRUE, 0) ON CONFLICT (id) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS file_migrations (
+			file_key TEXT NOT NULL,
+			bot_id BIGINT NOT NULL,
+			file_id TEXT,
+			error TEXT,
+			updated_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (file_key, bot_id)
+		);
+	`)
+	if err != nil {
+		return err
+	}
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS links (
 			id SERIAL PRIMARY KEY,
-			file_key TEXT NOT NULL UNIQUE,
+			file_key TEXT NOT NULL,
 			url TEXT NOT NULL,
 			created_at TIMESTAMPTZ NOT NULL
 		);
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`ALTER TABLE links DROP CONSTRAINT IF EXISTS links_file_key_key`,
+		`ALTER TABLE links ADD COLUMN IF NOT EXISTS code TEXT`,
+		`UPDATE links SET code = file_key WHERE code IS NULL`,
+		`ALTER TABLE links ALTER COLUMN code SET NOT NULL`,
+		`ALTER TABLE links ADD COLUMN IF NOT EXISTS label TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE links ADD COLUMN IF NOT EXISTS opens BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE links ADD COLUMN IF NOT EXISTS deliveries BIGINT NOT NULL DEFAULT 0`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS links_code_idx ON links (code)`,
+		`CREATE INDEX IF NOT EXISTS links_file_key_idx ON links (file_key)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func openPostgres(cfg *Config) (*sql.DB, error) {
 	dsn := cfg.databaseDSN()
-	fmt.Println("dsn", dsn)
 	var db *sql.DB
 	var err error
 	for i := 0; i < 5; i++ {
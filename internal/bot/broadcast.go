@@ -0,0 +1,347 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	broadcastCallbackPrefix = "bc_"
+	broadcastSend           = "bc_send"
+	broadcastDiscard        = "bc_discard"
+	broadcastPause          = "bc_pause"
+	broadcastResume         = "bc_resume"
+	broadcastCancel         = "bc_cancel"
+
+	broadcastStatusInterval = 3 * time.Second
+	broadcastPausePoll      = 500 * time.Millisecond
+	broadcastMaxRetries     = 3
+)
+
+// broadcastOptions are the filters given to /broadcast.
+type broadcastOptions struct {
+	lang    string
+	days    int // only users seen in the last days; 0 means everyone
+	fileKey string
+}
+
+// parseBroadcastOptions reads lang=<code>, active=<days> and file=<key>.
+func parseBroadcastOptions(args []string) (broadcastOptions, bool) {
+	var opts broadcastOptions
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return opts, false
+		}
+		switch strings.ToLower(key) {
+		case "lang":
+			opts.lang = strings.ToLower(value)
+		case "active":
+			days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+			if err != nil || days <= 0 {
+				return opts, false
+			}
+			opts.days = days
+		case "file":
+			opts.fileKey = value
+		default:
+			return opts, false
+		}
+	}
+	return opts, true
+}
+
+func (o broadcastOptions) activeSince() time.Time {
+	if o.days == 0 {
+		return time.Time{}
+	}
+	return time.Now().AddDate(0, 0, -o.days)
+}
+
+// broadcastDraft is a message waiting for the admin to confirm the broadcast.
+type broadcastDraft struct {
+	opts      broadcastOptions
+	fromChat  int64
+	messageID int
+	audience  []int64
+}
+
+// broadcast is a running broadcast and its progress, shown in a status
+// message the admin can pause, resume or cancel it from.
+type broadcast struct {
+	draft    *broadcastDraft
+	chatID   int64
+	statusID int
+	loc      Localization
+
+	mu        sync.Mutex
+	sent      int
+	blocked   int
+	failed    int
+	paused    bool
+	cancelled bool
+}
+
+func (b *Bot) handleBroadcast(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	opts, ok := parseBroadcastOptions(b.parseArgs(message.CommandArguments()))
+	if !ok {
+		b.reply(message.Chat.ID, loc.Text("broadcast_usage"))
+		return
+	}
+	if opts.fileKey != "" {
+		record, err := b.getFile(opts.fileKey)
+		if err != nil {
+			b.logger.ErrorContext(ctx, "broadcast file lookup", "file_key", opts.fileKey, "err", err)
+			b.reply(message.Chat.ID, loc.Text("info_failed"))
+			return
+		}
+		if record == nil {
+			b.reply(message.Chat.ID, loc.Text("info_not_found"))
+			return
+		}
+	}
+	b.setConversation(message.From.ID, conversation{kind: convAwaitingBroadcast, data: message.CommandArguments()})
+	b.reply(message.Chat.ID, loc.Text("broadcast_prompt"))
+}
+
+// handleBroadcastMessage takes the admin's message, of any type, as the
+// broadcast and asks for confirmation with the audience size.
+func (b *Bot) handleBroadcastMessage(ctx context.Context, message *tgbotapi.Message, args string) {
+	if !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	opts, _ := parseBroadcastOptions(b.parseArgs(args))
+	audience, err := b.userRepo.Audience(opts.lang, opts.activeSince())
+	if err != nil {
+		b.logger.ErrorContext(ctx, "load broadcast audience", "err", err)
+		b.reply(message.Chat.ID, loc.Text("broadcast_failed"))
+		return
+	}
+	if len(audience) == 0 {
+		b.reply(message.Chat.ID, loc.Text("broadcast_no_audience"))
+		return
+	}
+
+	b.castMu.Lock()
+	b.drafts[message.From.ID] = &broadcastDraft{
+		opts:      opts,
+		fromChat:  message.Chat.ID,
+		messageID: message.MessageID,
+		audience:  audience,
+	}
+	b.castMu.Unlock()
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, loc.Text("broadcast_confirm", len(audience)))
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_broadcast_send"), broadcastSend),
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_discard"), broadcastDiscard),
+		),
+	)
+	if _, err := b.send(msg); err != nil {
+		b.logger.ErrorContext(ctx, "send broadcast confirmation", "err", err)
+	}
+}
+
+func (b *Bot) handleBroadcastCallback(ctx context.Context, cq *tgbotapi.CallbackQuery) {
+	if cq.From == nil || !b.isAdmin(cq.From.ID) {
+		return
+	}
+	loc := b.userLocale(cq.From)
+	chatID, messageID := cq.Message.Chat.ID, cq.Message.MessageID
+
+	b.castMu.Lock()
+	defer b.castMu.Unlock()
+	switch cq.Data {
+	case broadcastSend:
+		draft := b.drafts[cq.From.ID]
+		delete(b.drafts, cq.From.ID)
+		if draft == nil {
+			b.editText(chatID, messageID, loc.Text("broadcast_expired"))
+			return
+		}
+		if b.casting != nil {
+			b.editText(chatID, messageID, loc.Text("broadcast_busy"))
+			return
+		}
+		cast := &broadcast{draft: draft, chatID: chatID, statusID: messageID, loc: loc}
+		b.casting = cast
+		b.logger.InfoContext(ctx, "broadcast started", "audience", len(draft.audience))
+		go b.runBroadcast(ctx, cast)
+	case broadcastDiscard:
+		delete(b.drafts, cq.From.ID)
+		b.editText(chatID, messageID, loc.Text("broadcast_discarded"))
+	case broadcastPause, broadcastResume, broadcastCancel:
+		cast := b.casting
+		if cast == nil || cast.statusID != messageID {
+			return
+		}
+		cast.mu.Lock()
+		switch cq.Data {
+		case broadcastPause:
+			cast.paused = true
+		case broadcastResume:
+			cast.paused = false
+		case broadcastCancel:
+			cast.cancelled = true
+		}
+		cast.mu.Unlock()
+		b.showBroadcastStatus(cast, false)
+	}
+}
+
+// runBroadcast copies the draft to every user at broadcast_rate messages per
+// second, refreshing the status message as it goes.
+func (b *Bot) runBroadcast(ctx context.Context, cast *broadcast) {
+	defer func() {
+		b.castMu.Lock()
+		b.casting = nil
+		b.castMu.Unlock()
+	}()
+
+	rate := b.getConfig().BroadcastRate
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+	lastStatus := time.Now()
+	b.showBroadcastStatus(cast, false)
+
+	for _, userID := range cast.draft.audience {
+		if !b.waitWhilePaused(ctx, cast) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		outcome := b.deliverBroadcast(ctx, cast.draft, userID)
+		cast.mu.Lock()
+		switch outcome {
+		case "sent":
+			cast.sent++
+		case "blocked":
+			cast.blocked++
+		default:
+			cast.failed++
+		}
+		cast.mu.Unlock()
+		if time.Since(lastStatus) >= broadcastStatusInterval {
+			b.showBroadcastStatus(cast, false)
+			lastStatus = time.Now()
+		}
+	}
+	b.showBroadcastStatus(cast, true)
+	cast.mu.Lock()
+	b.logger.InfoContext(ctx, "broadcast finished", "sent", cast.sent, "blocked", cast.blocked, "failed", cast.failed, "cancelled", cast.cancelled)
+	cast.mu.Unlock()
+}
+
+// waitWhilePaused blocks while the broadcast is paused and reports whether it
+// should go on.
+func (b *Bot) waitWhilePaused(ctx context.Context, cast *broadcast) bool {
+	for {
+		cast.mu.Lock()
+		paused, cancelled := cast.paused, cast.cancelled
+		cast.mu.Unlock()
+		if cancelled {
+			return false
+		}
+		if !paused {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(broadcastPausePoll):
+		}
+	}
+}
+
+// deliverBroadcast copies the broadcast to one user and reports sent, blocked
+// or failed. It waits out the long 429s that request gives up on, since a
+// broadcast runs in the background.
+func (b *Bot) deliverBroadcast(ctx context.Context, draft *broadcastDraft, userID int64) string {
+	msg := tgbotapi.NewCopyMessage(userID, draft.fromChat, draft.messageID)
+	if draft.opts.fileKey != "" {
+		loc := b.Localization(draft.opts.lang)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonURL(loc.Text("button_open_file"), b.fileLink(draft.opts.fileKey)),
+			),
+		)
+	}
+	for attempt := 0; ; attempt++ {
+		_, err := b.request(msg)
+		if err == nil {
+			return "sent"
+		}
+		var apiErr *tgbotapi.Error
+		if !errors.As(err, &apiErr) {
+			b.logger.WarnContext(ctx, "broadcast delivery", "user_id", userID, "err", err)
+			return "failed"
+		}
+		switch {
+		case apiErr.Code == 403:
+			return "blocked"
+		case apiErr.Code == 429 && attempt < broadcastMaxRetries:
+			wait := time.Duration(apiErr.RetryAfter) * time.Second
+			b.logger.WarnContext(ctx, "broadcast rate limited", "retry_after", wait)
+			select {
+			case <-ctx.Done():
+				return "failed"
+			case <-time.After(wait):
+			}
+		default:
+			b.logger.WarnContext(ctx, "broadcast delivery", "user_id", userID, "err", err)
+			return "failed"
+		}
+	}
+}
+
+func (b *Bot) showBroadcastStatus(cast *broadcast, finished bool) {
+	cast.mu.Lock()
+	done := cast.sent + cast.blocked + cast.failed
+	state := "broadcast_running"
+	switch {
+	case finished && cast.cancelled:
+		state = "broadcast_cancelled"
+	case finished:
+		state = "broadcast_done"
+	case cast.cancelled:
+		state = "broadcast_cancelling"
+	case cast.paused:
+		state = "broadcast_paused"
+	}
+	text := cast.loc.Text("broadcast_status", cast.loc.Text(state), done, len(cast.draft.audience), cast.sent, cast.blocked, cast.failed)
+	paused := cast.paused
+	cast.mu.Unlock()
+
+	if finished {
+		b.editText(cast.chatID, cast.statusID, text)
+		return
+	}
+	toggle := tgbotapi.NewInlineKeyboardButtonData(cast.loc.Text("button_pause"), broadcastPause)
+	if paused {
+		toggle = tgbotapi.NewInlineKeyboardButtonData(cast.loc.Text("button_resume"), broadcastResume)
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(cast.chatID, cast.statusID, text, tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(toggle, tgbotapi.NewInlineKeyboardButtonData(cast.loc.Text("button_cancel"), broadcastCancel)),
+	))
+	if _, err := b.send(edit); err != nil {
+		b.logger.Warn("edit broadcast status", "err", err)
+	}
+}
@@ -0,0 +1,31 @@
+package bot
+
+import "testing"
+
+func TestParseBroadcastOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		want   broadcastOptions
+		wantOK bool
+	}{
+		{"no filters", nil, broadcastOptions{}, true},
+		{"all filters", []string{"lang=FA", "active=30", "file=abc"}, broadcastOptions{lang: "fa", days: 30, fileKey: "abc"}, true},
+		{"days suffix", []string{"active=7d"}, broadcastOptions{days: 7}, true},
+		{"keys ignore case", []string{"LANG=en"}, broadcastOptions{lang: "en"}, true},
+		{"zero days", []string{"active=0"}, broadcastOptions{}, false},
+		{"negative days", []string{"active=-3"}, broadcastOptions{}, false},
+		{"bad days", []string{"active=week"}, broadcastOptions{}, false},
+		{"empty value", []string{"lang="}, broadcastOptions{}, false},
+		{"no equals sign", []string{"fa"}, broadcastOptions{}, false},
+		{"unknown key", []string{"country=ir"}, broadcastOptions{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseBroadcastOptions(tt.args)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Fatalf("parseBroadcastOptions(%q) = %+v, %v, want %+v, %v", tt.args, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
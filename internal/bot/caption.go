@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CaptionRules controls how uploaded captions are cleaned up before storing.
+type CaptionRules struct {
+	// AllowedMentions are kept as-is instead of being replaced by the default tag.
+	AllowedMentions []string `yaml:"allowed_mentions"`
+	// RewriteTelegramLinks points t.me links (except allowed ones) at our channel.
+	RewriteTelegramLinks bool `yaml:"rewrite_telegram_links"`
+	// StripExternalLinks removes non-Telegram URLs and unlinks text links.
+	StripExternalLinks bool                 `yaml:"strip_external_links"`
+	Replacements       []CaptionReplacement `yaml:"replacements"`
+}
+
+// CaptionReplacement is a regexp substitution; Replace may use $1-style groups.
+type CaptionReplacement struct {
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+
+	re *regexp.Regexp
+}
+
+func (rules *CaptionRules) compile() error {
+	for i := range rules.Replacements {
+		re, err := regexp.Compile(rules.Replacements[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("caption_rules.replacements[%d]: %w", i, err)
+		}
+		rules.Replacements[i].re = re
+	}
+	return nil
+}
+
+func (rules *CaptionRules) allowed(username string) bool {
+	username = strings.TrimPrefix(username, "@")
+	for _, mention := range rules.AllowedMentions {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(mention), "@"), username) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply runs the regexp replacements and then rewrites mentions and links
+// according to the rules, keeping entities aligned with the new text.
+func (rules *CaptionRules) apply(text string, entities []tgbotapi.MessageEntity, tag string) (string, []tgbotapi.MessageEntity) {
+	for _, replacement := range rules.Replacements {
+		if replacement.re != nil {
+			text, entities = replacePattern(text, entities, replacement.re, replacement.Replace)
+		}
+	}
+
+	ownLink := "https://t.me/" + strings.TrimPrefix(tag, "@")
+	entities = append([]tgbotapi.MessageEntity(nil), entities...)
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type != "text_link" {
+			continue
+		}
+		if target, ok := telegramTarget(entity.URL); ok {
+			if rules.RewriteTelegramLinks && !rules.allowed(target) {
+				entity.URL = ownLink
+			}
+		} else if rules.StripExternalLinks {
+			entity.Type = ""
+		}
+	}
+
+	return rewriteEntities(text, entities, func(entity tgbotapi.MessageEntity, value string) (string, bool) {
+		switch entity.Type {
+		case "mention":
+			return tag, !rules.allowed(value)
+		case "url":
+			if target, ok := telegramTarget(value); ok {
+				return ownLink, rules.RewriteTelegramLinks && !rules.allowed(target)
+			}
+			return "", rules.StripExternalLinks
+		default:
+			return "", false
+		}
+	})
+}
+
+// telegramTarget returns the username a t.me link points at.
+func telegramTarget(link string) (string, bool) {
+	link = strings.TrimPrefix(strings.TrimPrefix(link, "https://"), "http://")
+	for _, host := range []string{"t.me/", "telegram.me/"} {
+		if strings.HasPrefix(strings.ToLower(link), host) {
+			target := link[len(host):]
+			if i := strings.IndexAny(target, "/?#"); i >= 0 {
+				target = target[:i]
+			}
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// replacePattern applies re to text. Matches that cut across an entity are
+// skipped so formatting can't be broken half-way.
+func replacePattern(text string, entities []tgbotapi.MessageEntity, re *regexp.Regexp, repl string) (string, []tgbotapi.MessageEntity) {
+	const matchType = "caption_rule_match"
+	expanded := make(map[int]string)
+	withMatches := append([]tgbotapi.MessageEntity(nil), entities...)
+	for _, match := range re.FindAllStringSubmatchIndex(text, -1) {
+		offset := utf16Len(text[:match[0]])
+		length := utf16Len(text[match[0]:match[1]])
+		if length == 0 || crossesEntity(entities, offset, offset+length) {
+			continue
+		}
+		expanded[offset] = string(re.ExpandString(nil, repl, text, match))
+		withMatches = append(withMatches, tgbotapi.MessageEntity{Type: matchType, Offset: offset, Length: length})
+	}
+	if len(expanded) == 0 {
+		return text, entities
+	}
+
+	text, withMatches = rewriteEntities(text, withMatches, func(entity tgbotapi.MessageEntity, _ string) (string, bool) {
+		if entity.Type != matchType {
+			return "", false
+		}
+		return expanded[entity.Offset], true
+	})
+	result := withMatches[:0]
+	for _, entity := range withMatches {
+		if entity.Type != matchType {
+			result = append(result, entity)
+		}
+	}
+	return text, result
+}
+
+// crossesEntity reports whether [start, end) overlaps an entity without being
+// fully inside it.
+func crossesEntity(entities []tgbotapi.MessageEntity, start, end int) bool {
+	for _, entity := range entities {
+		entityEnd := entity.Offset + entity.Length
+		if end <= entity.Offset || start >= entityEnd {
+			continue
+		}
+		if start < entity.Offset || end > entityEnd {
+			return true
+		}
+	}
+	return false
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// processCaption applies the caption rules, replacing @mentions with the
+// default tag, and renders the result, formatting included, as HTML. Mentions
+// and links are taken from the caption entities, so text inside code blocks
+// or e-mail addresses is left alone.
+func (b *Bot) processCaption(caption string, entities []tgbotapi.MessageEntity) string {
+	cfg := b.getConfig()
+	tag := cfg.DefaultTag
+	if caption == "" {
+		return html.EscapeString(tag)
+	}
+	cleaned, entities := cfg.CaptionRules.apply(caption, entities, tag)
+	if !strings.Contains(cleaned, tag) {
+		return html.EscapeString(tag)
+	}
+	return entitiesToHTML(cleaned, entities)
+}
+
+// handleTestCaption is a dry run of processCaption on the command argument.
+func (b *Bot) handleTestCaption(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := strings.TrimLeft(message.CommandArguments(), " \t\n")
+	if strings.TrimSpace(args) == "" {
+		b.reply(message.Chat.ID, loc.Text("testcaption_usage"))
+		return
+	}
+	caption, entities := sliceEntities(message.Text, message.Entities, len(message.Text)-len(args))
+	result := b.processCaption(caption, entities)
+	msg := tgbotapi.NewMessage(message.Chat.ID, loc.Text("testcaption_result", result))
+	msg.ParseMode = tgbotapi.ModeHTML
+	if _, err := b.send(msg); err != nil {
+		b.logger.ErrorContext(ctx, "send caption dry run", "err", err)
+		b.reply(message.Chat.ID, loc.Text("testcaption_result_html", result))
+	}
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestProcessCaption(t *testing.T) {
+	mention := func(offset, length int) tgbotapi.MessageEntity {
+		return tgbotapi.MessageEntity{Type: "mention", Offset: offset, Length: length}
+	}
+	url := func(offset, length int) tgbotapi.MessageEntity {
+		return tgbotapi.MessageEntity{Type: "url", Offset: offset, Length: length}
+	}
+	tests := []struct {
+		name     string
+		rules    CaptionRules
+		caption  string
+		entities []tgbotapi.MessageEntity
+		want     string
+	}{
+		{"empty caption gets the tag", CaptionRules{}, "", nil, "@tag"},
+		{"caption without the tag is replaced", CaptionRules{}, "just text", nil, "@tag"},
+		{"mention becomes the tag", CaptionRules{}, "by @other", []tgbotapi.MessageEntity{mention(3, 6)}, "by @tag"},
+		{
+			"allowed mention is kept",
+			CaptionRules{AllowedMentions: []string{"@Friend"}},
+			"@friend and @other",
+			[]tgbotapi.MessageEntity{mention(0, 7), mention(12, 6)},
+			"@friend and @tag",
+		},
+		{
+			"formatting survives a rewrite after an emoji",
+			CaptionRules{},
+			"😀 @other bold",
+			[]tgbotapi.MessageEntity{mention(3, 6), {Type: "bold", Offset: 10, Length: 4}},
+			"😀 @tag <b>bold</b>",
+		},
+		{
+			"telegram links are rewritten",
+			CaptionRules{RewriteTelegramLinks: true},
+			"@tag t.me/other",
+			[]tgbotapi.MessageEntity{mention(0, 4), url(5, 10)},
+			"@tag https://t.me/tag",
+		},
+		{
+			"external links are stripped",
+			CaptionRules{StripExternalLinks: true},
+			"@tag https://example.com",
+			[]tgbotapi.MessageEntity{mention(0, 4), url(5, 19)},
+			"@tag ",
+		},
+		{
+			"text links to other sites are unlinked",
+			CaptionRules{StripExternalLinks: true},
+			"@tag site",
+			[]tgbotapi.MessageEntity{mention(0, 4), {Type: "text_link", Offset: 5, Length: 4, URL: "https://example.com"}},
+			"@tag site",
+		},
+		{
+			"replacement keeps entities aligned",
+			CaptionRules{Replacements: []CaptionReplacement{{Pattern: `Season (\d+)`, Replace: "S$1"}}},
+			"Season 12 @tag <b>",
+			[]tgbotapi.MessageEntity{mention(10, 4), {Type: "bold", Offset: 15, Length: 3}},
+			"S12 @tag <b>&lt;b&gt;</b>",
+		},
+		{
+			"replacement crossing an entity is skipped",
+			CaptionRules{Replacements: []CaptionReplacement{{Pattern: `ab`, Replace: "x"}}},
+			"ab @tag",
+			[]tgbotapi.MessageEntity{{Type: "bold", Offset: 1, Length: 1}, mention(3, 4)},
+			"a<b>b</b> @tag",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := tt.rules
+			if err := rules.compile(); err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			b := &Bot{config: &Config{DefaultTag: "@tag", CaptionRules: rules}}
+			if got := b.processCaption(tt.caption, tt.entities); got != tt.want {
+				t.Fatalf("processCaption(%q) = %q, want %q", tt.caption, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramTarget(t *testing.T) {
+	tests := []struct {
+		link   string
+		want   string
+		wantOK bool
+	}{
+		{"https://t.me/channel", "channel", true},
+		{"http://telegram.me/channel/12?x=1", "channel", true},
+		{"T.ME/Channel", "Channel", true},
+		{"https://example.com/t.me/x", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			got, ok := telegramTarget(tt.link)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("telegramTarget(%q) = %q, %v, want %q, %v", tt.link, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix namespaces config overrides: db_password is read from
+// UPLOADER_DB_PASSWORD, or from the file named by UPLOADER_DB_PASSWORD_FILE.
+const envPrefix = "UPLOADER_"
+
+const redacted = "[redacted]"
+
+func envName(field string) string {
+	return envPrefix + strings.ToUpper(field)
+}
+
+// hasEnvConfig reports whether any UPLOADER_* variable is set, in which case
+// the config file becomes optional.
+func hasEnvConfig() bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnv overrides config fields from the environment. For each field the
+// secret file (<NAME>_FILE) wins over the plain variable, and both win over
+// the YAML value. Lists are comma separated; nested settings are YAML.
+func (cfg *Config) applyEnv() error {
+	value := reflect.ValueOf(cfg).Elem()
+	configType := value.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		if !configType.Field(i).IsExported() {
+			continue
+		}
+		name := yamlName(configType.Field(i))
+		raw, source, ok, err := lookupEnv(envName(name))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(i), raw); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+	}
+	return nil
+}
+
+func lookupEnv(name string) (value, source string, ok bool, err error) {
+	if path, set := os.LookupEnv(name + "_FILE"); set && path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(raw), "\r\n"), name + "_FILE", true, nil
+	}
+	if raw, set := os.LookupEnv(name); set {
+		return raw, name, true, nil
+	}
+	return "", "", false, nil
+}
+
+func setField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		v, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		field.SetBool(v)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return yaml.Unmarshal([]byte(raw), field.Addr().Interface())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return yaml.Unmarshal([]byte(raw), field.Addr().Interface())
+	}
+	return nil
+}
+
+// Redacted renders the config as YAML with secrets replaced, for logging.
+func (cfg *Config) Redacted() string {
+	copied := cfg.clone()
+	value := reflect.ValueOf(copied).Elem()
+	configType := value.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		if !configType.Field(i).IsExported() {
+			continue
+		}
+		field := value.Field(i)
+		if secretFields[yamlName(configType.Field(i))] && field.Kind() == reflect.String && field.String() != "" {
+			field.SetString(redacted)
+		}
+	}
+	raw, err := yaml.Marshal(copied)
+	if err != nil {
+		return err.Error()
+	}
+	return string(raw)
+}
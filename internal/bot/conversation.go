@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const conversationTTL = 5 * time.Minute
+
+const (
+	convAwaitingPost      = "awaiting_post"
+	convAwaitingBroadcast = "awaiting_broadcast"
+	convAwaitingPassword  = "awaiting_password"
+)
+
+// conversation tracks a user whose next message answers a question the bot
+// asked, e.g. the body of a text post. data carries whatever the question
+// needs to remember, such as the arguments of the command that asked it.
+type conversation struct {
+	kind    string
+	data    string
+	expires time.Time
+}
+
+func (b *Bot) setConversation(userID int64, conv conversation) {
+	if conv.expires.IsZero() {
+		conv.expires = time.Now().Add(conversationTTL)
+	}
+	b.convMu.Lock()
+	defer b.convMu.Unlock()
+	b.convs[userID] = conv
+}
+
+// takeConversation returns and clears the user's pending conversation.
+func (b *Bot) takeConversation(userID int64) (conversation, bool) {
+	b.convMu.Lock()
+	defer b.convMu.Unlock()
+	conv, ok := b.convs[userID]
+	if !ok {
+		return conversation{}, false
+	}
+	delete(b.convs, userID)
+	if time.Now().After(conv.expires) {
+		return conversation{}, false
+	}
+	return conv, true
+}
+
+// handleConversation passes a non-command message to the conversation its
+// sender is in and reports whether the message was consumed. Text posts and
+// passwords only take text, so media sent meanwhile is still uploaded as
+// usual.
+func (b *Bot) handleConversation(ctx context.Context, message *tgbotapi.Message) bool {
+	if message.From == nil {
+		return false
+	}
+	conv, ok := b.takeConversation(message.From.ID)
+	if !ok {
+		return false
+	}
+	switch conv.kind {
+	case convAwaitingPost:
+		if message.Text == "" {
+			b.setConversation(message.From.ID, conv)
+			return false
+		}
+		b.handlePostBody(ctx, message)
+	case convAwaitingPassword:
+		if message.Text == "" {
+			b.setConversation(message.From.ID, conv)
+			return false
+		}
+		b.handlePasswordAttempt(ctx, message, conv)
+	case convAwaitingBroadcast:
+		b.handleBroadcastMessage(ctx, message, conv.data)
+	}
+	return true
+}
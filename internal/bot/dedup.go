@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	duplicateCallbackPrefix = "dup_"
+	duplicateReuse          = "dup_reuse:"
+	duplicateNew            = "dup_new:"
+	pendingUploadTTL        = time.Hour
+)
+
+// pendingUpload is an upload held back until the admin decides what to do
+// with a file that already has a key.
+type pendingUpload struct {
+	record   *repository.FileRecord
+	existing *repository.FileRecord
+	created  time.Time
+}
+
+func pendingID(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d:%d", chatID, messageID)
+}
+
+// offerExisting checks whether the uploaded file is already stored and, if so,
+// asks the admin whether to reuse the existing link. It reports whether the
+// upload was parked waiting for that answer.
+func (b *Bot) offerExisting(ctx context.Context, message *tgbotapi.Message, record *repository.FileRecord) bool {
+	existing, err := b.fileRepo.FindByUniqueID(record.FileUniqueID)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "duplicate lookup", "err", err)
+		return false
+	}
+	if existing == nil {
+		return false
+	}
+
+	b.storePending(pendingID(message.Chat.ID, message.MessageID), &pendingUpload{
+		record:   record,
+		existing: existing,
+		created:  time.Now(),
+	})
+
+	loc := b.userLocale(message.From)
+	text := loc.Text("duplicate_prompt", existing.FileKey, b.fileLink(existing.FileKey))
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_reuse_link"), fmt.Sprintf("%s%d", duplicateReuse, message.MessageID)),
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_new_key"), fmt.Sprintf("%s%d", duplicateNew, message.MessageID)),
+		),
+	)
+	if _, err := b.send(msg); err != nil {
+		b.logger.ErrorContext(ctx, "send duplicate prompt", "file_key", existing.FileKey, "err", err)
+	}
+	return true
+}
+
+func (b *Bot) handleDuplicateChoice(ctx context.Context, cq *tgbotapi.CallbackQuery) {
+	if cq.From == nil || !b.isAdmin(cq.From.ID) {
+		return
+	}
+	chatID := cq.Message.Chat.ID
+	var messageID string
+	var reuse bool
+	switch {
+	case strings.HasPrefix(cq.Data, duplicateReuse):
+		messageID, reuse = strings.TrimPrefix(cq.Data, duplicateReuse), true
+	case strings.HasPrefix(cq.Data, duplicateNew):
+		messageID = strings.TrimPrefix(cq.Data, duplicateNew)
+	default:
+		return
+	}
+
+	loc := b.userLocale(cq.From)
+	upload := b.takePending(fmt.Sprintf("%d:%s", chatID, messageID))
+	if upload == nil {
+		b.editText(chatID, cq.Message.MessageID, loc.Text("duplicate_expired"))
+		return
+	}
+	if reuse {
+		b.editText(chatID, cq.Message.MessageID, loc.Text("duplicate_reused", b.fileLink(upload.existing.FileKey)))
+		return
+	}
+	b.editText(chatID, cq.Message.MessageID, loc.Text("duplicate_new_key"))
+	upload.record.FileKey = b.takeNextKey(cq.From.ID)
+	b.publishFile(ctx, chatID, upload.record, loc)
+}
+
+func (b *Bot) storePending(id string, upload *pendingUpload) {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	for key, p := range b.pending {
+		if time.Since(p.created) > pendingUploadTTL {
+			delete(b.pending, key)
+		}
+	}
+	b.pending[id] = upload
+}
+
+func (b *Bot) takePending(id string) *pendingUpload {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	upload, ok := b.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(b.pending, id)
+	if time.Since(upload.created) > pendingUploadTTL {
+		return nil
+	}
+	return upload
+}
+
+func (b *Bot) editText(chatID int64, messageID int, text string) {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	if _, err := b.send(edit); err != nil {
+		b.logger.Error("edit message", "chat_id", chatID, "message_id", messageID, "err", err)
+	}
+}
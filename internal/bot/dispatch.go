@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatQueue holds the updates of one chat waiting for its worker.
+type chatQueue struct {
+	updates []tgbotapi.Update
+}
+
+// updateChat is the chat an update belongs to; updates of one chat are
+// handled in order, different chats concurrently.
+func updateChat(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// dispatch queues an update for its chat's worker, starting one if the chat
+// has none, so a handler waiting on the rate limiter or a retry only holds up
+// its own chat.
+func (b *Bot) dispatch(ctx context.Context, update tgbotapi.Update) {
+	chatID := updateChat(update)
+	b.workMu.Lock()
+	defer b.workMu.Unlock()
+	if queue, ok := b.workers[chatID]; ok {
+		queue.updates = append(queue.updates, update)
+		return
+	}
+	queue := &chatQueue{updates: []tgbotapi.Update{update}}
+	b.workers[chatID] = queue
+	b.workWG.Add(1)
+	go b.work(ctx, chatID, queue)
+}
+
+// work handles a chat's updates until its queue is empty.
+func (b *Bot) work(ctx context.Context, chatID int64, queue *chatQueue) {
+	defer b.workWG.Done()
+	for {
+		b.workMu.Lock()
+		if len(queue.updates) == 0 {
+			delete(b.workers, chatID)
+			b.workMu.Unlock()
+			return
+		}
+		update := queue.updates[0]
+		queue.updates = queue.updates[1:]
+		b.workMu.Unlock()
+
+		updateCtx := updateContext(ctx, update)
+		if b.dropUpdate(updateCtx, update) {
+			continue
+		}
+		b.handleUpdate(updateCtx, update)
+	}
+}
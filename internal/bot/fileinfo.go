@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) handleInfo(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message.Chat.ID, loc.Text("info_usage"))
+		return
+	}
+	ctx = withLogAttrs(ctx, "file_key", args[0])
+	record, err := b.getFile(args[0])
+	if err != nil {
+		b.logger.ErrorContext(ctx, "info lookup", "err", err)
+		b.reply(message.Chat.ID, loc.Text("info_failed"))
+		return
+	}
+	if record == nil {
+		b.reply(message.Chat.ID, loc.Text("info_not_found"))
+		return
+	}
+	link := b.fileLink(record.FileKey)
+	if record.ParseMode != tgbotapi.ModeHTML {
+		b.reply(message.Chat.ID, fileInfo(record, link, loc, false))
+		return
+	}
+	b.replyHTML(message.Chat.ID, fileInfo(record, link, loc, true), fileInfo(record, link, loc, false))
+}
+
+func (b *Bot) fileLink(fileKey string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", strings.TrimPrefix(b.getBotUsername(), "@"), fileKey)
+}
+
+// fileInfo renders every stored field of a record for admins. With asHTML
+// the fields are escaped and an HTML caption is kept as markup.
+func fileInfo(record *repository.FileRecord, link string, loc Localization, asHTML bool) string {
+	escape := func(s string) string { return s }
+	if asHTML {
+		escape = html.EscapeString
+	}
+	var lines []string
+	add := func(key, value string) {
+		if value != "" {
+			lines = append(lines, escape(loc.Text(key)+": "+value))
+		}
+	}
+	add("info_key", record.FileKey)
+	add("info_link", link)
+	add("info_type", record.FileType)
+	add("info_name", record.FileName)
+	add("info_mime", record.MimeType)
+	if record.FileSize > 0 {
+		add("info_size", formatSize(record.FileSize))
+	}
+	if record.Duration > 0 {
+		add("info_duration", formatDuration(record.Duration))
+	}
+	if record.Width > 0 && record.Height > 0 {
+		add("info_resolution", fmt.Sprintf("%dx%d", record.Width, record.Height))
+	}
+	add("info_performer", record.Performer)
+	add("info_title", record.Title)
+	add("info_unique_id", record.FileUniqueID)
+	if record.PasswordHash != "" {
+		add("info_password", loc.Text("info_password_set"))
+	}
+	if !record.CreatedAt.IsZero() {
+		add("info_uploaded", record.CreatedAt.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	lines = append(lines, escape(loc.Text("info_caption")+": ")+record.Caption)
+	return strings.Join(lines, "\n")
+}
+
+// filePreview is the short summary users see before the file itself.
+// It is empty when Telegram sent no metadata worth showing.
+func filePreview(record *repository.FileRecord) string {
+	var lines []string
+	switch {
+	case record.Title != "" && record.Performer != "":
+		lines = append(lines, "🎵 "+record.Performer+" — "+record.Title)
+	case record.FileName != "":
+		lines = append(lines, "📄 "+record.FileName)
+	}
+	if record.FileSize > 0 {
+		lines = append(lines, "💾 "+formatSize(record.FileSize))
+	}
+	if record.Duration > 0 {
+		lines = append(lines, "⏱ "+formatDuration(record.Duration))
+	}
+	if record.Width > 0 && record.Height > 0 && record.FileType == "video" {
+		lines = append(lines, fmt.Sprintf("🖥 %dx%d", record.Width, record.Height))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGT"[exp])
+}
+
+func formatDuration(seconds int) string {
+	h, m, s := seconds/3600, seconds%3600/60, seconds%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// entitiesToHTML renders Telegram message entities as the HTML subset accepted
+// by parse_mode=HTML. Entity offsets are counted in UTF-16 code units.
+func entitiesToHTML(text string, entities []tgbotapi.MessageEntity) string {
+	if len(entities) == 0 {
+		return html.EscapeString(text)
+	}
+	units := utf16.Encode([]rune(text))
+
+	sorted := make([]tgbotapi.MessageEntity, 0, len(entities))
+	for _, entity := range entities {
+		if openTag(entity) == "" || entity.Length <= 0 || entity.Offset+entity.Length > len(units) {
+			continue
+		}
+		sorted = append(sorted, entity)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Offset != sorted[j].Offset {
+			return sorted[i].Offset < sorted[j].Offset
+		}
+		return sorted[i].Length > sorted[j].Length
+	})
+
+	var sb strings.Builder
+	var stack []tgbotapi.MessageEntity
+	next, pos := 0, 0
+	for pos <= len(units) {
+		for len(stack) > 0 && stack[len(stack)-1].Offset+stack[len(stack)-1].Length <= pos {
+			sb.WriteString(closeTag(stack[len(stack)-1]))
+			stack = stack[:len(stack)-1]
+		}
+		for next < len(sorted) && sorted[next].Offset == pos {
+			sb.WriteString(openTag(sorted[next]))
+			stack = append(stack, sorted[next])
+			next++
+		}
+		if pos == len(units) {
+			break
+		}
+		end := len(units)
+		if next < len(sorted) && sorted[next].Offset < end {
+			end = sorted[next].Offset
+		}
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.Offset+top.Length < end {
+				end = top.Offset + top.Length
+			}
+		}
+		sb.WriteString(html.EscapeString(string(utf16.Decode(units[pos:end]))))
+		pos = end
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		sb.WriteString(closeTag(stack[i]))
+	}
+	return sb.String()
+}
+
+func openTag(entity tgbotapi.MessageEntity) string {
+	switch entity.Type {
+	case "bold":
+		return "<b>"
+	case "italic":
+		return "<i>"
+	case "underline":
+		return "<u>"
+	case "strikethrough":
+		return "<s>"
+	case "spoiler":
+		return "<tg-spoiler>"
+	case "code":
+		return "<code>"
+	case "pre":
+		if entity.Language != "" {
+			return fmt.Sprintf(`<pre><code class="language-%s">`, html.EscapeString(entity.Language))
+		}
+		return "<pre>"
+	case "text_link":
+		return fmt.Sprintf(`<a href="%s">`, html.EscapeString(entity.URL))
+	case "text_mention":
+		if entity.User == nil {
+			return ""
+		}
+		return fmt.Sprintf(`<a href="tg://user?id=%d">`, entity.User.ID)
+	default:
+		return ""
+	}
+}
+
+func closeTag(entity tgbotapi.MessageEntity) string {
+	switch entity.Type {
+	case "bold":
+		return "</b>"
+	case "italic":
+		return "</i>"
+	case "underline":
+		return "</u>"
+	case "strikethrough":
+		return "</s>"
+	case "spoiler":
+		return "</tg-spoiler>"
+	case "code":
+		return "</code>"
+	case "pre":
+		if entity.Language != "" {
+			return "</code></pre>"
+		}
+		return "</pre>"
+	case "text_link", "text_mention":
+		return "</a>"
+	default:
+		return ""
+	}
+}
+
+// rewriteEntities replaces the text covered by entities for which replace
+// returns true, shifting the remaining entities so they keep pointing at the
+// same text. Entities enclosing a replaced range grow or shrink with it.
+func rewriteEntities(text string, entities []tgbotapi.MessageEntity, replace func(entity tgbotapi.MessageEntity, value string) (string, bool)) (string, []tgbotapi.MessageEntity) {
+	units := utf16.Encode([]rune(text))
+	result := make([]tgbotapi.MessageEntity, 0, len(entities))
+	for _, entity := range entities {
+		if entity.Offset >= 0 && entity.Length > 0 && entity.Offset+entity.Length <= len(units) {
+			result = append(result, entity)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Offset < result[j].Offset })
+
+	// Walk backwards so earlier offsets stay valid while later text changes.
+	for i := len(result) - 1; i >= 0; i-- {
+		entity := result[i]
+		start, end := entity.Offset, entity.Offset+entity.Length
+		value := string(utf16.Decode(units[start:end]))
+		replacement, ok := replace(entity, value)
+		if !ok || replacement == value {
+			continue
+		}
+		repl := utf16.Encode([]rune(replacement))
+		delta := len(repl) - entity.Length
+		units = append(units[:start:start], append(repl, units[end:]...)...)
+		for j := range result {
+			other := &result[j]
+			switch {
+			case j == i:
+				other.Length = len(repl)
+			case other.Offset >= end:
+				other.Offset += delta
+			case other.Offset <= start && other.Offset+other.Length >= end:
+				other.Length += delta
+			}
+		}
+	}
+
+	kept := result[:0]
+	for _, entity := range result {
+		if entity.Length > 0 {
+			kept = append(kept, entity)
+		}
+	}
+	return string(utf16.Decode(units)), kept
+}
+
+// sliceEntities returns text[start:] (start is a byte offset) together with
+// the entities that lie entirely inside it, re-based to the new text.
+func sliceEntities(text string, entities []tgbotapi.MessageEntity, start int) (string, []tgbotapi.MessageEntity) {
+	prefix := len(utf16.Encode([]rune(text[:start])))
+	var sliced []tgbotapi.MessageEntity
+	for _, entity := range entities {
+		if entity.Offset < prefix {
+			continue
+		}
+		entity.Offset -= prefix
+		sliced = append(sliced, entity)
+	}
+	return text[start:], sliced
+}
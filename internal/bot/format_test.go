@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestEntitiesToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tgbotapi.MessageEntity
+		want     string
+	}{
+		{"plain text is escaped", `a <b> & "c"`, nil, "a &lt;b&gt; &amp; &#34;c&#34;"},
+		{"bold", "hello world", []tgbotapi.MessageEntity{{Type: "bold", Offset: 6, Length: 5}}, "hello <b>world</b>"},
+		{
+			"offsets count UTF-16 units",
+			"😀 bold é",
+			[]tgbotapi.MessageEntity{{Type: "bold", Offset: 3, Length: 4}, {Type: "italic", Offset: 8, Length: 1}},
+			"😀 <b>bold</b> <i>é</i>",
+		},
+		{
+			"nested entities",
+			"abc",
+			[]tgbotapi.MessageEntity{{Type: "italic", Offset: 0, Length: 1}, {Type: "bold", Offset: 0, Length: 3}},
+			"<b><i>a</i>bc</b>",
+		},
+		{
+			"link URL is escaped",
+			"site",
+			[]tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 4, URL: `https://x.y/?a=1&b="2"`}},
+			`<a href="https://x.y/?a=1&amp;b=&#34;2&#34;">site</a>`,
+		},
+		{
+			"pre with language",
+			"x := 1",
+			[]tgbotapi.MessageEntity{{Type: "pre", Offset: 0, Length: 6, Language: "go"}},
+			`<pre><code class="language-go">x := 1</code></pre>`,
+		},
+		{
+			"unsupported and out of range entities are dropped",
+			"@name #tag",
+			[]tgbotapi.MessageEntity{{Type: "mention", Offset: 0, Length: 5}, {Type: "bold", Offset: 6, Length: 10}},
+			"@name #tag",
+		},
+		{
+			"text mention without user is dropped",
+			"you",
+			[]tgbotapi.MessageEntity{{Type: "text_mention", Offset: 0, Length: 3}},
+			"you",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := entitiesToHTML(tt.text, tt.entities); got != tt.want {
+				t.Fatalf("entitiesToHTML = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSliceEntities(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		entities     []tgbotapi.MessageEntity
+		start        int
+		wantText     string
+		wantEntities []tgbotapi.MessageEntity
+	}{
+		{
+			"entities before start are dropped",
+			"/cmd key text",
+			[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 4}, {Type: "bold", Offset: 9, Length: 4}},
+			9,
+			"text",
+			[]tgbotapi.MessageEntity{{Type: "bold", Offset: 0, Length: 4}},
+		},
+		{
+			"prefix is measured in UTF-16 units",
+			"😀é rest",
+			[]tgbotapi.MessageEntity{{Type: "italic", Offset: 4, Length: 4}},
+			len("😀é "),
+			"rest",
+			[]tgbotapi.MessageEntity{{Type: "italic", Offset: 0, Length: 4}},
+		},
+		{"no entities", "abc def", nil, 4, "def", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := sliceEntities(tt.text, tt.entities, tt.start)
+			if text != tt.wantText || !reflect.DeepEqual(entities, tt.wantEntities) {
+				t.Fatalf("sliceEntities = %q, %+v, want %q, %+v", text, entities, tt.wantText, tt.wantEntities)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	pollTimeout         = 30
+	pollRetryDelay      = 3 * time.Second
+	pollStaleAfter      = 2 * time.Minute
+	schedulerTick       = time.Second
+	schedulerStaleAfter = 30 * time.Second
+	probeTimeout        = 3 * time.Second
+)
+
+// pollUpdates long-polls getUpdates and records every successful poll, so a
+// stalled update loop is visible even when no user is writing to the bot.
+func (b *Bot) pollUpdates(ctx context.Context) <-chan tgbotapi.Update {
+	updates := make(chan tgbotapi.Update, 100)
+	go func() {
+		defer close(updates)
+		config := tgbotapi.NewUpdate(0)
+		config.Timeout = pollTimeout
+		for ctx.Err() == nil {
+			batch, err := b.api.GetUpdates(config)
+			if err != nil {
+				countTelegramError(config, err)
+				b.logger.Warn("get updates", "err", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(pollRetryDelay):
+				}
+				continue
+			}
+			b.lastPoll.Store(time.Now().UnixNano())
+			for _, update := range batch {
+				if update.UpdateID >= config.Offset {
+					config.Offset = update.UpdateID + 1
+				}
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return updates
+}
+
+type healthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// liveness covers what a restart fixes: the update loop and the deletion
+// scheduler making progress.
+func (b *Bot) liveness() map[string]healthCheck {
+	checks := map[string]healthCheck{
+		"updates":   ageCheck("last poll", b.lastPoll.Load(), pollStaleAfter),
+		"scheduler": ageCheck("last tick", b.lastTick.Load(), schedulerStaleAfter),
+	}
+	if last := b.lastUpdate.Load(); last != 0 {
+		checks["last_update"] = healthCheck{OK: true, Detail: since(last)}
+	}
+	return checks
+}
+
+// readiness adds the dependencies the bot needs to serve users.
+func (b *Bot) readiness(ctx context.Context) map[string]healthCheck {
+	checks := b.liveness()
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if err := b.db.PingContext(ctx); err != nil {
+		checks["database"] = healthCheck{Detail: err.Error()}
+	} else {
+		checks["database"] = healthCheck{OK: true}
+	}
+	if err := b.pingTelegram(ctx); err != nil {
+		checks["telegram"] = healthCheck{Detail: scrubPatterns(err.Error())}
+	} else {
+		checks["telegram"] = healthCheck{OK: true}
+	}
+	return checks
+}
+
+// pingTelegram calls getMe, giving up when ctx is done; the client has no
+// per-request deadline, so a stalled connection would otherwise hang the
+// probe.
+func (b *Bot) pingTelegram(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.api.GetMe()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func ageCheck(label string, last int64, max time.Duration) healthCheck {
+	age := time.Since(time.Unix(0, last))
+	return healthCheck{OK: age <= max, Detail: fmt.Sprintf("%s %s", label, since(last))}
+}
+
+func since(unixNano int64) string {
+	return time.Since(time.Unix(0, unixNano)).Round(time.Second).String() + " ago"
+}
+
+func (b *Bot) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, b.liveness())
+}
+
+func (b *Bot) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, b.readiness(r.Context()))
+}
+
+// writeHealth answers 200 when every check passes and 503 otherwise, with the
+// individual results as JSON.
+func writeHealth(w http.ResponseWriter, checks map[string]healthCheck) {
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Status string                 `json:"status"`
+		Checks map[string]healthCheck `json:"checks"`
+	}{status, checks})
+}
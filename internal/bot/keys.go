@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// keyPattern is what Telegram accepts as a start parameter.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func validKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// takeNextKey returns and clears the key an admin picked for their next
+// upload, or "" for a generated one.
+func (b *Bot) takeNextKey(userID int64) string {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	key := b.nextKeys[userID]
+	delete(b.nextKeys, userID)
+	return key
+}
+
+// handleNextKey picks the key of the admin's next upload: /nextkey <key>, or
+// /nextkey off to go back to a generated one.
+func (b *Bot) handleNextKey(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message.Chat.ID, loc.Text("nextkey_usage"))
+		return
+	}
+	if strings.EqualFold(args[0], "off") {
+		b.takeNextKey(message.From.ID)
+		b.reply(message.Chat.ID, loc.Text("nextkey_cleared"))
+		return
+	}
+	key := args[0]
+	if !b.checkNewKey(ctx, message, key) {
+		return
+	}
+	b.pendingMu.Lock()
+	b.nextKeys[message.From.ID] = key
+	b.pendingMu.Unlock()
+	b.reply(message.Chat.ID, loc.Text("nextkey_set", key))
+}
+
+// handleSetKey renames a file's key: /setkey <key> <new_key> [keep], where
+// keep leaves the old key working as an alias.
+func (b *Bot) handleSetKey(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) < 2 || len(args) > 3 || (len(args) == 3 && !strings.EqualFold(args[2], "keep")) {
+		b.reply(message.Chat.ID, loc.Text("setkey_usage"))
+		return
+	}
+	oldKey, newKey, keep := args[0], args[1], len(args) == 3
+	ctx = withLogAttrs(ctx, "file_key", oldKey)
+	if !b.checkNewKey(ctx, message, newKey) {
+		return
+	}
+	found, err := b.fileRepo.Rename(oldKey, newKey, keep)
+	if errors.Is(err, repository.ErrKeyTaken) {
+		b.reply(message.Chat.ID, loc.Text("key_taken", newKey))
+		return
+	}
+	if err != nil {
+		b.logger.ErrorContext(ctx, "rename key", "new_key", newKey, "err", err)
+		b.reply(message.Chat.ID, loc.Text("setkey_failed"))
+		return
+	}
+	if !found {
+		b.reply(message.Chat.ID, loc.Text("info_not_found"))
+		return
+	}
+	b.logger.InfoContext(ctx, "file key changed", "new_key", newKey, "alias_kept", keep)
+	done := "setkey_done"
+	if keep {
+		done = "setkey_done_alias"
+	}
+	b.reply(message.Chat.ID, loc.Text(done, newKey, b.fileLink(newKey)))
+}
+
+// checkNewKey validates a chosen key and makes sure it is free, replying to
+// the admin when it is not.
+func (b *Bot) checkNewKey(ctx context.Context, message *tgbotapi.Message, key string) bool {
+	loc := b.userLocale(message.From)
+	if !validKey(key) {
+		b.reply(message.Chat.ID, loc.Text("key_invalid"))
+		return false
+	}
+	taken, err := b.fileRepo.KeyTaken(key)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "check key", "key", key, "err", err)
+		b.reply(message.Chat.ID, loc.Text("setkey_failed"))
+		return false
+	}
+	if taken {
+		b.reply(message.Chat.ID, loc.Text("key_taken", key))
+		return false
+	}
+	return true
+}
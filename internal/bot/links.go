@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aliebadimehr/telegram-uploader-bot/internal/link"
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxLabelLength keeps link labels short enough to read in /links and to use
+// as a metric label.
+const maxLabelLength = 32
+
+// resolveKey finds the file a start payload names: a file key, an alias or
+// the code of a link, which is returned too so the delivery can be credited
+// to it. The link made at upload has the file key as its code.
+func (b *Bot) resolveKey(key string) (*repository.FileRecord, *link.Link, error) {
+	source, err := b.linkRepo.FindByCode(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileKey := key
+	if source != nil {
+		fileKey = source.FileKey
+	}
+	record, err := b.getFile(fileKey)
+	if err != nil || record == nil {
+		return nil, nil, err
+	}
+	return record, source, nil
+}
+
+// linkSource names a link in metrics: its label, or direct for plain links.
+func linkSource(source *link.Link) string {
+	if source == nil || source.Label == "" {
+		return "direct"
+	}
+	return source.Label
+}
+
+func (b *Bot) countOpen(ctx context.Context, source *link.Link) {
+	if source == nil {
+		return
+	}
+	if err := b.linkRepo.CountOpen(source.ID); err != nil {
+		b.logger.WarnContext(ctx, "count link open", "link_id", source.ID, "err", err)
+	}
+}
+
+func (b *Bot) countDelivery(ctx context.Context, source *link.Link) {
+	linkDeliveriesTotal.WithLabelValues(linkSource(source)).Inc()
+	if source == nil {
+		return
+	}
+	if err := b.linkRepo.CountDelivery(source.ID); err != nil {
+		b.logger.WarnContext(ctx, "count link delivery", "link_id", source.ID, "err", err)
+	}
+}
+
+// handleNewLink creates another link to a file for one place it is shared:
+// /newlink <key> <label>.
+func (b *Bot) handleNewLink(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) < 2 {
+		b.reply(message.Chat.ID, loc.Text("newlink_usage"))
+		return
+	}
+	label := strings.Join(args[1:], " ")
+	if len([]rune(label)) > maxLabelLength {
+		b.reply(message.Chat.ID, loc.Text("newlink_label_too_long", maxLabelLength))
+		return
+	}
+	ctx = withLogAttrs(ctx, "file_key", args[0])
+	record, err := b.getFile(args[0])
+	if err != nil {
+		b.logger.ErrorContext(ctx, "fetch file", "err", err)
+		b.reply(message.Chat.ID, loc.Text("info_failed"))
+		return
+	}
+	if record == nil {
+		b.reply(message.Chat.ID, loc.Text("info_not_found"))
+		return
+	}
+	code, err := link.NewCode()
+	if err != nil {
+		b.logger.ErrorContext(ctx, "generate link code", "err", err)
+		b.reply(message.Chat.ID, loc.Text("newlink_failed"))
+		return
+	}
+	tracked := &link.Link{FileKey: record.FileKey, Code: code, Label: label, URL: b.fileLink(code)}
+	if err := b.linkRepo.Save(tracked); err != nil {
+		b.logger.ErrorContext(ctx, "save link", "err", err)
+		b.reply(message.Chat.ID, loc.Text("newlink_failed"))
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("newlink_done", label, tracked.URL))
+}
+
+// handleLinks lists a file's links with how often each was opened and
+// delivered: /links <key>.
+func (b *Bot) handleLinks(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message.Chat.ID, loc.Text("links_usage"))
+		return
+	}
+	ctx = withLogAttrs(ctx, "file_key", args[0])
+	record, err := b.getFile(args[0])
+	if err != nil {
+		b.logger.ErrorContext(ctx, "fetch file", "err", err)
+		b.reply(message.Chat.ID, loc.Text("info_failed"))
+		return
+	}
+	if record == nil {
+		b.reply(message.Chat.ID, loc.Text("info_not_found"))
+		return
+	}
+	links, err := b.linkRepo.ListByFile(record.FileKey)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "list links", "err", err)
+		b.reply(message.Chat.ID, loc.Text("info_failed"))
+		return
+	}
+	if len(links) == 0 {
+		b.reply(message.Chat.ID, loc.Text("links_empty"))
+		return
+	}
+	lines := make([]string, 0, len(links))
+	for _, l := range links {
+		label := l.Label
+		if label == "" {
+			label = loc.Text("links_direct")
+		}
+		lines = append(lines, fmt.Sprintf("• %s — %s\n  %s", label, loc.Text("links_counts", l.Opens, l.Deliveries), l.URL))
+	}
+	b.reply(message.Chat.ID, loc.Text("links_list", record.FileKey, strings.Join(lines, "\n")))
+}
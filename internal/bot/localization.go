@@ -1,53 +1,334 @@
 package bot
 
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed locales/*.yaml
+var embeddedLocales embed.FS
+
+const baseLanguage = "en"
+
+// Localization holds every user-facing text of one language, keyed by the
+// names used in locales/*.yaml.
 type Localization struct {
-	WarningText  string
-	WelcomeText  string
-	JoinText     string
-	NotFoundText string
+	Lang  string
+	texts map[string]string
 }
 
-var (
-	localization = Localization{
-		WarningText:  "⚠️ فایل‌ها بعد از ۳۰ ثانیه حذف خواهند شد",
-		WelcomeText:  "سلام! برای دانلود روی لینک فایل کلیک کنید.",
-		JoinText:     "لطفاً ابتدا در کانال‌های زیر عضو شوید:",
-		NotFoundText: "فایل پیدا نشد یا لینک منقضی شده است.",
+// Text returns the text for key, formatted with args when given.
+func (l Localization) Text(key string, args ...any) string {
+	text, ok := l.texts[key]
+	if !ok {
+		return key
 	}
-)
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
 
-func (l Localization) WithWarning(text string) Localization {
+// With returns a copy of l with key set to text; an empty text keeps the
+// current value.
+func (l Localization) With(key, text string) Localization {
 	if text == "" {
 		return l
 	}
-	l.WarningText = text
+	texts := make(map[string]string, len(l.texts)+1)
+	for k, v := range l.texts {
+		texts[k] = v
+	}
+	texts[key] = text
+	l.texts = texts
 	return l
 }
 
+func (l Localization) WithWarning(text string) Localization {
+	return l.With("warning", text)
+}
+
 func (l Localization) WithWelcome(text string) Localization {
-	if text == "" {
-		return l
-	}
-	l.WelcomeText = text
-	return l
+	return l.With("welcome", text)
 }
 
 func (l Localization) WithJoin(text string) Localization {
-	if text == "" {
-		return l
-	}
-	l.JoinText = text
-	return l
+	return l.With("join", text)
 }
 
 func (l Localization) WithNotFound(text string) Localization {
-	if text == "" {
+	return l.With("not_found", text)
+}
+
+// localeSet is every loaded language plus the one used when a user's
+// language is unknown.
+type localeSet struct {
+	fallback string
+	locales  map[string]Localization
+}
+
+// loadLocales reads the embedded locales and, when dir is set, the
+// <lang>.yaml files in it, which override or add languages. Missing keys are
+// filled from the fallback language and then from English.
+func loadLocales(dir, fallback string) (*localeSet, error) {
+	raw := make(map[string]map[string]string)
+	if err := readLocaleFiles(embeddedLocales, "locales", raw); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := readLocaleFiles(os.DirFS(dir), ".", raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if fallback == "" {
+		fallback = baseLanguage
+	}
+	if _, ok := raw[fallback]; !ok {
+		return nil, fmt.Errorf("default language %q has no locale file", fallback)
+	}
+
+	set := &localeSet{fallback: fallback, locales: make(map[string]Localization, len(raw))}
+	for lang, texts := range raw {
+		merged := make(map[string]string)
+		for _, source := range []map[string]string{raw[baseLanguage], raw[fallback], texts} {
+			for k, v := range source {
+				merged[k] = v
+			}
+		}
+		set.locales[lang] = Localization{Lang: lang, texts: merged}
+	}
+	return set, nil
+}
+
+func readLocaleFiles(fsys fs.FS, dir string, into map[string]map[string]string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, filepath.ToSlash(filepath.Join(dir, entry.Name())))
+		if err != nil {
+			return err
+		}
+		var texts map[string]string
+		if err := yaml.Unmarshal(data, &texts); err != nil {
+			return fmt.Errorf("locale %s: %w", entry.Name(), err)
+		}
+		lang := strings.TrimSuffix(entry.Name(), ".yaml")
+		if into[lang] == nil {
+			into[lang] = make(map[string]string)
+		}
+		for k, v := range texts {
+			into[lang][k] = v
+		}
+	}
+	return nil
+}
+
+// get resolves lang ("en", "pt-br", …) to a loaded locale, trying the base
+// language before falling back to the default one.
+func (s *localeSet) get(lang string) Localization {
+	lang = strings.ToLower(lang)
+	if l, ok := s.locales[lang]; ok {
 		return l
 	}
-	l.NotFoundText = text
-	return l
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		if l, ok := s.locales[lang[:i]]; ok {
+			return l
+		}
+	}
+	return s.locales[s.fallback]
+}
+
+func (s *localeSet) has(lang string) bool {
+	_, ok := s.locales[strings.ToLower(lang)]
+	return ok
 }
 
-func (b *Bot) Localization() Localization {
-	return localization
+// withOverrides returns a copy of the set with admin-edited texts applied.
+// Overrides for unknown languages or keys, or whose placeholders no longer
+// match the locale file, are ignored.
+func (s *localeSet) withOverrides(overrides []repository.BotText) *localeSet {
+	set := &localeSet{fallback: s.fallback, locales: make(map[string]Localization, len(s.locales))}
+	for lang, l := range s.locales {
+		set.locales[lang] = l
+	}
+	for _, override := range overrides {
+		l, ok := set.locales[override.Lang]
+		if !ok {
+			continue
+		}
+		base, known := l.texts[override.Key]
+		if !known {
+			continue
+		}
+		if !slices.Equal(formatVerbs(override.Text), formatVerbs(base)) {
+			continue
+		}
+		set.locales[override.Lang] = l.With(override.Key, override.Text)
+	}
+	return set
+}
+
+func (l Localization) keys() []string {
+	keys := make([]string, 0, len(l.texts))
+	for key := range l.texts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *localeSet) languages() []string {
+	langs := make([]string, 0, len(s.locales))
+	for lang := range s.locales {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Localization returns the texts used for the given language code.
+func (b *Bot) Localization(lang string) Localization {
+	return b.getLocales().get(lang)
+}
+
+func (b *Bot) getLocales() *localeSet {
+	b.localesMu.RLock()
+	defer b.localesMu.RUnlock()
+	return b.locales
+}
+
+// userLocale picks the user's /lang choice, then their Telegram language.
+func (b *Bot) userLocale(user *tgbotapi.User) Localization {
+	if user == nil {
+		return b.getLocales().get("")
+	}
+	if lang := b.languageOverride(user.ID); lang != "" {
+		return b.getLocales().get(lang)
+	}
+	return b.getLocales().get(user.LanguageCode)
+}
+
+// langCacheTTL bounds how long a /lang choice is cached, so the cache only
+// holds recently active users and picks up changes made on other replicas.
+const langCacheTTL = time.Minute
+
+type cachedLang struct {
+	lang   string
+	loaded time.Time
+}
+
+func (b *Bot) languageOverride(userID int64) string {
+	b.langMu.RLock()
+	cached, ok := b.langs[userID]
+	b.langMu.RUnlock()
+	if ok && time.Since(cached.loaded) < langCacheTTL {
+		return cached.lang
+	}
+	lang, err := b.prefRepo.Language(userID)
+	if err != nil {
+		b.logger.Error("load language", "user_id", userID, "err", err)
+		return ""
+	}
+	b.cacheLanguage(userID, lang)
+	return lang
+}
+
+func (b *Bot) setLanguage(userID int64, lang string) error {
+	if err := b.prefRepo.SetLanguage(userID, lang); err != nil {
+		return err
+	}
+	b.cacheLanguage(userID, lang)
+	return nil
+}
+
+func (b *Bot) cacheLanguage(userID int64, lang string) {
+	b.langMu.Lock()
+	defer b.langMu.Unlock()
+	now := time.Now()
+	if now.Sub(b.langsSwept) > langCacheTTL {
+		for id, cached := range b.langs {
+			if now.Sub(cached.loaded) > langCacheTTL {
+				delete(b.langs, id)
+			}
+		}
+		b.langsSwept = now
+	}
+	b.langs[userID] = cachedLang{lang: lang, loaded: now}
+}
+
+const langCallbackPrefix = "lang:"
+
+func (b *Bot) handleLang(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) == 0 {
+		loc := b.userLocale(message.From)
+		msg := tgbotapi.NewMessage(message.Chat.ID, loc.Text("lang_choose"))
+		msg.ReplyMarkup = b.buildLanguageKeyboard()
+		if _, err := b.send(msg); err != nil {
+			b.logger.ErrorContext(ctx, "send language menu", "err", err)
+		}
+		return
+	}
+	b.chooseLanguage(ctx, message.Chat.ID, message.From, args[0])
+}
+
+func (b *Bot) handleLangCallback(ctx context.Context, cq *tgbotapi.CallbackQuery) {
+	if cq.From == nil {
+		return
+	}
+	b.chooseLanguage(ctx, cq.Message.Chat.ID, cq.From, strings.TrimPrefix(cq.Data, langCallbackPrefix))
+}
+
+// chooseLanguage stores lang for the user; "auto" clears the override.
+func (b *Bot) chooseLanguage(ctx context.Context, chatID int64, user *tgbotapi.User, lang string) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "auto" {
+		lang = ""
+	}
+	if lang != "" && !b.getLocales().has(lang) {
+		loc := b.userLocale(user)
+		b.reply(chatID, loc.Text("lang_unknown", lang, strings.Join(b.getLocales().languages(), ", ")))
+		return
+	}
+	if err := b.setLanguage(user.ID, lang); err != nil {
+		b.logger.ErrorContext(ctx, "save language", "err", err)
+		b.reply(chatID, b.userLocale(user).Text("lang_failed"))
+		return
+	}
+	loc := b.userLocale(user)
+	if lang == "" {
+		b.reply(chatID, loc.Text("lang_reset"))
+		return
+	}
+	b.reply(chatID, loc.Text("lang_set", loc.Text("language_name")))
+}
+
+func (b *Bot) buildLanguageKeyboard() tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, lang := range b.getLocales().languages() {
+		name := b.getLocales().get(lang).Text("language_name")
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(name, langCallbackPrefix+lang))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
 }
@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	// botTokenRe matches Telegram bot tokens, which also appear inside API
+	// URLs quoted by network errors.
+	botTokenRe = regexp.MustCompile(`\d{5,}:[A-Za-z0-9_-]{30,}`)
+	// dsnPasswordRe matches the password part of a connection URL.
+	dsnPasswordRe = regexp.MustCompile(`(\w+://[^:/@\s]*:)[^@\s]+@`)
+)
+
+// NewLogger builds the logger described by cfg: text or JSON on stdout at
+// cfg.LogLevel, with every secret known to cfg scrubbed from messages and
+// attributes. The returned level can be changed while the logger is in use.
+func NewLogger(cfg *Config) (*slog.Logger, *slog.LevelVar, error) {
+	level := new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, nil, fmt.Errorf("log_level: %w", err)
+	}
+	var out io.Writer = os.Stdout
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.LogFormat {
+	case "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, nil, fmt.Errorf("log_format %q must be text or json", cfg.LogFormat)
+	}
+	return slog.New(&logHandler{next: handler, redact: secretReplacer(cfg)}), level, nil
+}
+
+// secretReplacer replaces every secret value in cfg, including a password in
+// POSTGRES_DSN, with a placeholder.
+func secretReplacer(cfg *Config) *strings.Replacer {
+	secrets := []string{cfg.APIToken, cfg.AdminPassword, cfg.DBPassword, cfg.LinkSecret}
+	if parsed, err := url.Parse(cfg.databaseDSN()); err == nil && parsed.User != nil {
+		if password, ok := parsed.User.Password(); ok {
+			secrets = append(secrets, password, url.QueryEscape(password))
+		}
+	}
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+type logAttrsKey struct{}
+
+// withLogAttrs returns a context whose log records carry args as attributes,
+// e.g. the update, user and chat a handler is working on.
+func withLogAttrs(ctx context.Context, args ...any) context.Context {
+	var attrs []slog.Attr
+	if existing, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		attrs = append(attrs, existing...)
+	}
+	attrs = append(attrs, slog.Group("", args...).Value.Group()...)
+	return context.WithValue(ctx, logAttrsKey{}, attrs)
+}
+
+// updateContext tags ctx with the IDs of update for every log record written
+// while handling it.
+func updateContext(ctx context.Context, update tgbotapi.Update) context.Context {
+	args := []any{"update_id", update.UpdateID}
+	if user := update.SentFrom(); user != nil {
+		args = append(args, "user_id", user.ID)
+	}
+	if chat := update.FromChat(); chat != nil {
+		args = append(args, "chat_id", chat.ID)
+	}
+	return withLogAttrs(ctx, args...)
+}
+
+// logHandler adds the attributes stored by withLogAttrs and redacts secrets
+// before passing records on.
+type logHandler struct {
+	next   slog.Handler
+	redact *strings.Replacer
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	scrubbed := slog.NewRecord(record.Time, record.Level, h.scrub(record.Message), record.PC)
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		scrubbed.AddAttrs(attrs...)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		scrubbed.AddAttrs(h.scrubAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, scrubbed)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		scrubbed[i] = h.scrubAttr(attr)
+	}
+	return &logHandler{next: h.next.WithAttrs(scrubbed), redact: h.redact}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{next: h.next.WithGroup(name), redact: h.redact}
+}
+
+func (h *logHandler) scrubAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.scrub(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		scrubbed := make([]any, len(group))
+		for i, member := range group {
+			scrubbed[i] = h.scrubAttr(member)
+		}
+		return slog.Group(attr.Key, scrubbed...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, h.scrub(v.Error()))
+		case fmt.Stringer:
+			return slog.String(attr.Key, h.scrub(v.String()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+func (h *logHandler) scrub(text string) string {
+	return scrubPatterns(h.redact.Replace(text))
+}
+
+// scrubPatterns hides anything shaped like a bot token or a connection URL
+// password, whether or not it comes from the config.
+func scrubPatterns(text string) string {
+	text = botTokenRe.ReplaceAllString(text, redacted)
+	return dsnPasswordRe.ReplaceAllString(text, "${1}"+redacted+"@")
+}
+
+// redactError strips secrets from errors that leave the package before a
+// logger exists, such as Telegram errors quoting the bot API URL.
+func redactError(err error) error {
+	return errors.New(scrubPatterns(err.Error()))
+}
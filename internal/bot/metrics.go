@@ -0,0 +1,221 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+	factory  = promauto.With(registry)
+
+	updatesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_updates_total",
+		Help: "Telegram updates received, by type.",
+	}, []string{"type"})
+	commandDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "uploader_command_duration_seconds",
+		Help: "Time spent handling a command.",
+	}, []string{"command"})
+	deliveriesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_deliveries_total",
+		Help: "Files requested through links, by file type and outcome.",
+	}, []string{"file_type", "outcome"})
+	linkDeliveriesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_link_deliveries_total",
+		Help: "Files delivered, by the label of the link they were requested through (direct for plain links).",
+	}, []string{"source"})
+	membershipChecksTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_membership_checks_total",
+		Help: "Sponsored channel membership checks, by channel and result (hit, miss, error).",
+	}, []string{"channel", "result"})
+	telegramErrorsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_telegram_errors_total",
+		Help: "Failed Telegram Bot API calls, by method and error code (0 for network errors).",
+	}, []string{"method", "code"})
+	telegramRetriesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_telegram_retries_total",
+		Help: "Retried Telegram Bot API calls, by method and reason (rate_limited, server_error, network).",
+	}, []string{"method", "reason"})
+	rateLimitWaitSeconds = factory.NewCounter(prometheus.CounterOpts{
+		Name: "uploader_rate_limit_wait_seconds_total",
+		Help: "Time outgoing messages spent waiting for the rate limiter.",
+	})
+	droppedUpdatesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_dropped_updates_total",
+		Help: "Updates ignored because the sender is banned or over the request rate.",
+	}, []string{"reason"})
+	autoBansTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "uploader_auto_bans_total",
+		Help: "Users blocked automatically, by reason (flood, not_found).",
+	}, []string{"reason"})
+	pendingDeletions = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "uploader_pending_deletions",
+		Help: "Delivered messages waiting to be deleted.",
+	})
+	dbQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "uploader_db_query_duration_seconds",
+		Help: "Database query latency, by statement type.",
+	}, []string{"operation"})
+)
+
+// updateType names the kind of update for metrics.
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.Message == nil:
+		return "other"
+	case update.Message.IsCommand():
+		return "command"
+	case hasMedia(update.Message):
+		return "media"
+	case update.Message.Text != "":
+		return "text"
+	default:
+		return "other"
+	}
+}
+
+// send and request wrap the Bot API calls so they are rate limited, retried
+// and counted when they fail.
+func (b *Bot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+	err := b.call(c, func() (err error) {
+		msg, err = b.api.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+func (b *Bot) request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := b.call(c, func() (err error) {
+		resp, err = b.api.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+func (b *Bot) call(c tgbotapi.Chattable, do func() error) error {
+	for attempt := 0; ; attempt++ {
+		b.throttle(c)
+		err := do()
+		if err == nil {
+			return nil
+		}
+		wait, reason, retry := retryDelay(err, attempt, createsMessage(c))
+		if !retry {
+			b.apiFailed(c, err)
+			return err
+		}
+		method := apiMethod(c)
+		telegramRetriesTotal.WithLabelValues(method, reason).Inc()
+		b.logger.Warn("retrying telegram call", "method", method, "reason", reason, "wait", wait, "err", err)
+		time.Sleep(wait)
+	}
+}
+
+// apiFailed counts a failed call and flags users who blocked the bot, which
+// Telegram reports as 403 on their private chat.
+func (b *Bot) apiFailed(c tgbotapi.Chattable, err error) {
+	countTelegramError(c, err)
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 403 {
+		b.markBlocked(chatIDOf(c))
+	}
+}
+
+func countTelegramError(c tgbotapi.Chattable, err error) {
+	code := "0"
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		code = strconv.Itoa(apiErr.Code)
+	}
+	telegramErrorsTotal.WithLabelValues(apiMethod(c), code).Inc()
+}
+
+// apiMethod derives a method label from the request type, e.g.
+// tgbotapi.DeleteMessageConfig becomes deleteMessage.
+func apiMethod(c tgbotapi.Chattable) string {
+	name := fmt.Sprintf("%T", c)
+	name = name[strings.LastIndex(name, ".")+1:]
+	name = strings.TrimSuffix(name, "Config")
+	if name == "" {
+		return "unknown"
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// timedDB records the latency of every repository query, including those
+// run in transactions.
+type timedDB struct {
+	db *sql.DB
+}
+
+var _ repository.DB = timedDB{}
+
+func (t timedDB) Exec(query string, args ...any) (sql.Result, error) {
+	defer prometheus.NewTimer(dbQueryDuration.WithLabelValues(queryOperation(query))).ObserveDuration()
+	return t.db.Exec(query, args...)
+}
+
+func (t timedDB) Query(query string, args ...any) (*sql.Rows, error) {
+	defer prometheus.NewTimer(dbQueryDuration.WithLabelValues(queryOperation(query))).ObserveDuration()
+	return t.db.Query(query, args...)
+}
+
+func (t timedDB) QueryRow(query string, args ...any) *sql.Row {
+	defer prometheus.NewTimer(dbQueryDuration.WithLabelValues(queryOperation(query))).ObserveDuration()
+	return t.db.QueryRow(query, args...)
+}
+
+func (t timedDB) Begin() (repository.Tx, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return timedTx{tx}, nil
+}
+
+// timedTx records the latency of the queries run in a transaction.
+type timedTx struct {
+	*sql.Tx
+}
+
+func (t timedTx) Exec(query string, args ...any) (sql.Result, error) {
+	defer prometheus.NewTimer(dbQueryDuration.WithLabelValues(queryOperation(query))).ObserveDuration()
+	return t.Tx.Exec(query, args...)
+}
+
+func (t timedTx) Query(query string, args ...any) (*sql.Rows, error) {
+	defer prometheus.NewTimer(dbQueryDuration.WithLabelValues(queryOperation(query))).ObserveDuration()
+	return t.Tx.Query(query, args...)
+}
+
+func (t timedTx) QueryRow(query string, args ...any) *sql.Row {
+	defer prometheus.NewTimer(dbQueryDuration.WithLabelValues(queryOperation(query))).ObserveDuration()
+	return t.Tx.QueryRow(query, args...)
+}
+
+// queryOperation is the statement's first keyword, which keeps the label set
+// small.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(fields[0])
+}
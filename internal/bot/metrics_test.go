@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestAPIMethod(t *testing.T) {
+	tests := []struct {
+		c    tgbotapi.Chattable
+		want string
+	}{
+		{tgbotapi.NewMessage(1, "hi"), "message"},
+		{tgbotapi.NewDeleteMessage(1, 2), "deleteMessage"},
+		{tgbotapi.NewCopyMessage(1, 2, 3), "copyMessage"},
+		{tgbotapi.NewCallback("id", ""), "callback"},
+		{&tgbotapi.DocumentConfig{}, "document"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := apiMethod(tt.c); got != tt.want {
+				t.Fatalf("apiMethod(%T) = %q, want %q", tt.c, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryOperation(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "select"},
+		{"\n\t\tINSERT INTO files (file_key) VALUES ($1)", "insert"},
+		{"update links SET opens = opens + 1", "update"},
+		{"", "unknown"},
+		{"   ", "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := queryOperation(tt.query); got != tt.want {
+				t.Fatalf("queryOperation(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
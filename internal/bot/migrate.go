@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MigrateOptions describes a move of the file library from one bot to another.
+// The storage channel must have both bots as administrators.
+type MigrateOptions struct {
+	OldToken       string
+	NewToken       string
+	StorageChannel string
+	Delay          time.Duration
+}
+
+type MigrationFailure struct {
+	FileKey string
+	Err     error
+}
+
+type MigrationReport struct {
+	Migrated int
+	Skipped  int
+	Failures []MigrationFailure
+}
+
+// Migrate re-sends every stored file through the storage channel so the new bot
+// obtains its own file_id, then rewrites the files table in place. Files already
+// migrated to the new bot are skipped, so an interrupted run can be restarted.
+func Migrate(ctx context.Context, cfg *Config, opts MigrateOptions, logger *slog.Logger) (*MigrationReport, error) {
+	if opts.OldToken == "" || opts.NewToken == "" || opts.StorageChannel == "" {
+		return nil, errors.New("old token, new token and storage channel are required")
+	}
+	if opts.OldToken == opts.NewToken {
+		return nil, errors.New("old and new tokens are identical")
+	}
+
+	oldAPI, err := tgbotapi.NewBotAPI(opts.OldToken)
+	if err != nil {
+		return nil, fmt.Errorf("old bot: %w", redactError(err))
+	}
+	newAPI, err := tgbotapi.NewBotAPI(opts.NewToken)
+	if err != nil {
+		return nil, fmt.Errorf("new bot: %w", redactError(err))
+	}
+	channelID, err := resolveChatID(newAPI, opts.StorageChannel)
+	if err != nil {
+		return nil, fmt.Errorf("resolve storage channel: %w", err)
+	}
+
+	db, err := openPostgres(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect db: %w", err)
+	}
+	defer db.Close()
+
+	fileRepo := repository.NewFileRepository(timedDB{db: db})
+	migrationRepo := repository.NewMigrationRepository(timedDB{db: db})
+
+	records, err := fileRepo.List()
+	if err != nil {
+		return nil, fmt.Errorf("list files: %w", err)
+	}
+	logger.Info("migrating files", "count", len(records), "from", oldAPI.Self.UserName, "to", newAPI.Self.UserName)
+
+	report := &MigrationReport{}
+	for i := range records {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		record := &records[i]
+		if record.FileType == "text" {
+			// Text posts have no file_id to carry over.
+			report.Skipped++
+			continue
+		}
+		done, err := migrationRepo.IsMigrated(record.FileKey, newAPI.Self.ID)
+		if err != nil {
+			return report, fmt.Errorf("check migration state: %w", err)
+		}
+		if done {
+			report.Skipped++
+			continue
+		}
+
+		fileID, err := migrateFile(oldAPI, newAPI, channelID, record, logger)
+		if err != nil {
+			logger.Error("migrate file", "file_key", record.FileKey, "err", err)
+			report.Failures = append(report.Failures, MigrationFailure{FileKey: record.FileKey, Err: err})
+			if markErr := migrationRepo.MarkFailed(record.FileKey, newAPI.Self.ID, err.Error()); markErr != nil {
+				return report, fmt.Errorf("record failure: %w", markErr)
+			}
+		} else {
+			report.Migrated++
+			if err := migrationRepo.MarkMigrated(record.FileKey, newAPI.Self.ID, fileID); err != nil {
+				return report, fmt.Errorf("record migration: %w", err)
+			}
+		}
+
+		if opts.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-time.After(opts.Delay):
+			}
+		}
+	}
+	return report, nil
+}
+
+// migrateFile posts the file to the storage channel with the old bot and has the
+// new bot forward that post, which yields a file_id valid for the new bot. Both
+// posts are deleted afterwards so the channel does not fill up across runs.
+func migrateFile(oldAPI, newAPI *tgbotapi.BotAPI, channelID int64, record *repository.FileRecord, logger *slog.Logger) (string, error) {
+	msg, err := buildMediaConfig(channelID, record)
+	if err != nil {
+		return "", err
+	}
+	posted, err := oldAPI.Send(msg)
+	if err != nil {
+		return "", fmt.Errorf("upload with old bot: %w", err)
+	}
+	forwarded, err := newAPI.Send(tgbotapi.NewForward(channelID, channelID, posted.MessageID))
+	if err != nil {
+		return "", fmt.Errorf("forward with new bot: %w", err)
+	}
+	if _, err := newAPI.Request(tgbotapi.NewDeleteMessage(channelID, forwarded.MessageID)); err != nil {
+		logger.Warn("delete forwarded copy", "message_id", forwarded.MessageID, "err", err)
+	}
+	if _, err := oldAPI.Request(tgbotapi.NewDeleteMessage(channelID, posted.MessageID)); err != nil {
+		logger.Warn("delete old bot's post", "message_id", posted.MessageID, "err", err)
+	}
+	media := mediaFromMessage(&forwarded)
+	if media == nil {
+		return "", errors.New("forwarded message carries no media")
+	}
+	if media.FileType != record.FileType {
+		return "", fmt.Errorf("forwarded media type %s does not match %s", media.FileType, record.FileType)
+	}
+	return media.FileID, nil
+}
+
+func resolveChatID(api *tgbotapi.BotAPI, channel string) (int64, error) {
+	channel = strings.TrimSpace(channel)
+	if id, err := strconv.ParseInt(channel, 10, 64); err == nil {
+		return id, nil
+	}
+	normalized := normalizeChannel(channel)
+	if normalized == "" {
+		return 0, fmt.Errorf("invalid channel %q", channel)
+	}
+	chat, err := api.GetChat(tgbotapi.ChatInfoConfig{
+		ChatConfig: tgbotapi.ChatConfig{SuperGroupUsername: "@" + normalized},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return chat.ID, nil
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxPasswordAttempts = 3
+	passwordLockout     = 15 * time.Minute
+)
+
+// hashPassword returns "<salt>:<sha256(salt+password)>" in hex.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append(salt, password...))
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+func checkPassword(hash, password string) bool {
+	saltHex, sumHex, ok := strings.Cut(hash, ":")
+	if !ok {
+		return false
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(sumHex)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(append(salt, password...))
+	return subtle.ConstantTimeCompare(sum[:], want) == 1
+}
+
+// passwordLockedFor is how long the user must wait after running out of
+// password attempts.
+func (b *Bot) passwordLockedFor(userID int64) time.Duration {
+	b.lockMu.Lock()
+	defer b.lockMu.Unlock()
+	until, ok := b.pwLocks[userID]
+	if !ok {
+		return 0
+	}
+	if wait := time.Until(until); wait > 0 {
+		return wait
+	}
+	delete(b.pwLocks, userID)
+	return 0
+}
+
+// passwordFailures counts a user's wrong passwords since the first one
+// within passwordLockout.
+type passwordFailures struct {
+	count int
+	since time.Time
+}
+
+// failPassword counts a wrong password and reports how many attempts the
+// user has left. The count outlives the prompt, so asking again with another
+// /start does not reset it, but it starts over once passwordLockout has
+// passed since the first failure; running out locks the user out.
+func (b *Bot) failPassword(userID int64) int {
+	b.lockMu.Lock()
+	defer b.lockMu.Unlock()
+	now := time.Now()
+	for id, fails := range b.pwFails {
+		if now.Sub(fails.since) > passwordLockout {
+			delete(b.pwFails, id)
+		}
+	}
+	fails, ok := b.pwFails[userID]
+	if !ok {
+		fails = passwordFailures{since: now}
+	}
+	fails.count++
+	left := maxPasswordAttempts - fails.count
+	if left <= 0 {
+		delete(b.pwFails, userID)
+		b.pwLocks[userID] = now.Add(passwordLockout)
+		return left
+	}
+	b.pwFails[userID] = fails
+	return left
+}
+
+func (b *Bot) clearPasswordFailures(userID int64) {
+	b.lockMu.Lock()
+	defer b.lockMu.Unlock()
+	delete(b.pwFails, userID)
+}
+
+// askPassword waits for the user's next message to be the file's password.
+// The conversation keeps the key the user opened, so a tracked link is still
+// credited once the password is right.
+func (b *Bot) askPassword(ctx context.Context, message *tgbotapi.Message, record *repository.FileRecord, key string) {
+	loc := b.userLocale(message.From)
+	if wait := b.passwordLockedFor(message.From.ID); wait > 0 {
+		b.reply(message.Chat.ID, loc.Text("password_locked", minutesLeft(wait)))
+		deliveriesTotal.WithLabelValues(record.FileType, "password_locked").Inc()
+		return
+	}
+	b.setConversation(message.From.ID, conversation{kind: convAwaitingPassword, data: key})
+	b.reply(message.Chat.ID, loc.Text("password_prompt"))
+	deliveriesTotal.WithLabelValues(record.FileType, "password_required").Inc()
+}
+
+func (b *Bot) handlePasswordAttempt(ctx context.Context, message *tgbotapi.Message, conv conversation) {
+	loc := b.userLocale(message.From)
+	ctx = withLogAttrs(ctx, "file_key", conv.data)
+	record, source, err := b.resolveKey(conv.data)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "fetch file", "err", err)
+		b.reply(message.Chat.ID, loc.Text("error_retry"))
+		return
+	}
+	if record == nil {
+		b.reply(message.Chat.ID, loc.Text("not_found"))
+		return
+	}
+	if record.PasswordHash == "" || checkPassword(record.PasswordHash, strings.TrimSpace(message.Text)) {
+		b.clearPasswordFailures(message.From.ID)
+		b.deliverFile(ctx, message.Chat.ID, record, source, loc)
+		return
+	}
+
+	left := b.failPassword(message.From.ID)
+	if left <= 0 {
+		b.logger.WarnContext(ctx, "password attempts exhausted")
+		b.reply(message.Chat.ID, loc.Text("password_locked", int(passwordLockout.Minutes())))
+		deliveriesTotal.WithLabelValues(record.FileType, "password_locked").Inc()
+		return
+	}
+	b.setConversation(message.From.ID, conv)
+	b.reply(message.Chat.ID, loc.Text("password_wrong", left))
+}
+
+// handleSetPassword protects a file with a password, or removes it:
+// /setpassword <key> [password].
+func (b *Bot) handleSetPassword(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) == 0 {
+		b.reply(message.Chat.ID, loc.Text("setpassword_usage"))
+		return
+	}
+	fileKey, password := args[0], strings.Join(args[1:], " ")
+	ctx = withLogAttrs(ctx, "file_key", fileKey)
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			b.logger.ErrorContext(ctx, "hash password", "err", err)
+			b.reply(message.Chat.ID, loc.Text("setpassword_failed"))
+			return
+		}
+	}
+	found, err := b.fileRepo.SetPassword(fileKey, hash)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "set password", "err", err)
+		b.reply(message.Chat.ID, loc.Text("setpassword_failed"))
+		return
+	}
+	if !found {
+		b.reply(message.Chat.ID, loc.Text("info_not_found"))
+		return
+	}
+	if hash == "" {
+		b.reply(message.Chat.ID, loc.Text("setpassword_cleared", fileKey))
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("setpassword_done", fileKey))
+}
@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"context"
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) handleNewPost(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	b.setConversation(message.From.ID, conversation{kind: convAwaitingPost})
+	b.reply(message.Chat.ID, b.userLocale(message.From).Text("newpost_prompt"))
+}
+
+func (b *Bot) handleCancel(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	if _, ok := b.takeConversation(message.From.ID); ok {
+		b.reply(message.Chat.ID, b.userLocale(message.From).Text("cancelled"))
+	}
+}
+
+// handlePostBody stores the admin's message as a text post rendered to HTML
+// so its entities survive delivery.
+func (b *Bot) handlePostBody(ctx context.Context, message *tgbotapi.Message) {
+	if !b.isAdmin(message.From.ID) {
+		return
+	}
+	b.publishFile(ctx, message.Chat.ID, &repository.FileRecord{
+		FileKey:   b.takeNextKey(message.From.ID),
+		FileType:  "text",
+		Caption:   entitiesToHTML(message.Text, message.Entities),
+		ParseMode: tgbotapi.ModeHTML,
+	}, b.userLocale(message.From))
+}
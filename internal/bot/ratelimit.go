@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram allows about 30 messages a second overall, one a second to the
+// same private chat and 20 a minute to the same group; bursts are tolerated
+// briefly.
+const (
+	globalRate  = 30
+	globalBurst = 30
+	chatRate    = 1
+	chatBurst   = 3
+	groupRate   = 20.0 / 60
+	groupBurst  = 5
+
+	// idle chat buckets are full again and can be dropped
+	bucketIdle = time.Minute
+
+	maxAttempts   = 4
+	retryBackoff  = 500 * time.Millisecond
+	maxRetryAfter = 10 * time.Second
+)
+
+// bucket is a token bucket that may go into debt: a call always takes a
+// token and waits until the bucket would have had one.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (bk *bucket) reserve(now time.Time, rate, burst float64) time.Duration {
+	bk.tokens = math.Min(burst, bk.tokens+now.Sub(bk.last).Seconds()*rate)
+	bk.last = now
+	bk.tokens--
+	if bk.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bk.tokens / rate * float64(time.Second))
+}
+
+// rateLimiter spaces outgoing messages to stay under Telegram's limits.
+type rateLimiter struct {
+	mu     sync.Mutex
+	global bucket
+	chats  map[int64]*bucket
+	swept  time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	now := time.Now()
+	return &rateLimiter{
+		global: bucket{tokens: globalBurst, last: now},
+		chats:  make(map[int64]*bucket),
+		swept:  now,
+	}
+}
+
+// reserve books a message to chatID and returns how long to wait before
+// sending it.
+func (l *rateLimiter) reserve(chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > bucketIdle {
+		for id, bk := range l.chats {
+			if now.Sub(bk.last) > bucketIdle {
+				delete(l.chats, id)
+			}
+		}
+		l.swept = now
+	}
+
+	rate, burst := float64(chatRate), float64(chatBurst)
+	if chatID < 0 {
+		rate, burst = groupRate, groupBurst
+	}
+	bk, ok := l.chats[chatID]
+	if !ok {
+		bk = &bucket{tokens: burst, last: now}
+		l.chats[chatID] = bk
+	}
+	return max(l.global.reserve(now, globalRate, globalBurst), bk.reserve(now, rate, burst))
+}
+
+// throttle waits for a slot when c posts a message. Lookups, deletions and
+// callback answers are not counted against the message limits.
+func (b *Bot) throttle(c tgbotapi.Chattable) {
+	switch c.(type) {
+	case tgbotapi.MessageConfig, tgbotapi.PhotoConfig, tgbotapi.VideoConfig, tgbotapi.DocumentConfig,
+		tgbotapi.AudioConfig, tgbotapi.AnimationConfig, tgbotapi.VoiceConfig, tgbotapi.VideoNoteConfig,
+		tgbotapi.StickerConfig, tgbotapi.CopyMessageConfig, tgbotapi.ForwardConfig,
+		tgbotapi.EditMessageTextConfig, tgbotapi.EditMessageCaptionConfig, tgbotapi.EditMessageReplyMarkupConfig:
+	default:
+		return
+	}
+	if wait := b.limiter.reserve(chatIDOf(c)); wait > 0 {
+		rateLimitWaitSeconds.Add(wait.Seconds())
+		time.Sleep(wait)
+	}
+}
+
+// retryDelay reports whether a failed call should be retried and after how
+// long: 429s after their retry_after, server errors with exponential backoff.
+// Network errors are retried the same way only when the request cannot have
+// reached Telegram or repeating it is harmless (resend is false), since a
+// timeout on a send may come after the message went out. Waits longer than
+// maxRetryAfter are left to the caller rather than holding up the chat's
+// worker.
+func retryDelay(err error, attempt int, resend bool) (time.Duration, string, bool) {
+	if attempt+1 >= maxAttempts {
+		return 0, "", false
+	}
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		if resend && !notSent(err) {
+			return 0, "", false
+		}
+		return retryBackoff << attempt, "network", true
+	}
+	switch {
+	case apiErr.Code == 429:
+		wait := time.Duration(apiErr.RetryAfter) * time.Second
+		if wait > maxRetryAfter {
+			return 0, "", false
+		}
+		return max(wait, retryBackoff), "rate_limited", true
+	case apiErr.Code >= 500:
+		return retryBackoff << attempt, "server_error", true
+	}
+	return 0, "", false
+}
+
+// notSent reports whether a network error happened before the request went
+// out: the connection could not be opened or the host not resolved.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// createsMessage reports whether a call posts a new message, so repeating it
+// after an uncertain failure could deliver it twice.
+func createsMessage(c tgbotapi.Chattable) bool {
+	switch c.(type) {
+	case tgbotapi.MessageConfig, tgbotapi.PhotoConfig, tgbotapi.VideoConfig, tgbotapi.DocumentConfig,
+		tgbotapi.AudioConfig, tgbotapi.AnimationConfig, tgbotapi.VoiceConfig, tgbotapi.VideoNoteConfig,
+		tgbotapi.StickerConfig, tgbotapi.CopyMessageConfig, tgbotapi.ForwardConfig, tgbotapi.MediaGroupConfig:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRetryDelay(t *testing.T) {
+	rateLimited := func(seconds int) error {
+		return &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: seconds}}
+	}
+	timeout := errors.New("Post \"https://api.telegram.org/...\": context deadline exceeded")
+	refused := fmt.Errorf("post: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	tests := []struct {
+		name       string
+		err        error
+		attempt    int
+		resend     bool
+		wantWait   time.Duration
+		wantReason string
+		wantRetry  bool
+	}{
+		{"429 waits retry_after", rateLimited(3), 0, true, 3 * time.Second, "rate_limited", true},
+		{"429 waits at least the backoff", rateLimited(0), 0, true, retryBackoff, "rate_limited", true},
+		{"long 429 is left to the caller", rateLimited(30), 0, true, 0, "", false},
+		{"server error backs off", &tgbotapi.Error{Code: 502}, 2, true, 4 * retryBackoff, "server_error", true},
+		{"client error is final", &tgbotapi.Error{Code: 400}, 0, true, 0, "", false},
+		{"last attempt is final", &tgbotapi.Error{Code: 502}, maxAttempts - 1, true, 0, "", false},
+		{"network error on a repeatable call", timeout, 1, false, 2 * retryBackoff, "network", true},
+		{"network error on a send is final", timeout, 0, true, 0, "", false},
+		{"refused connection on a send is retried", refused, 0, true, retryBackoff, "network", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, reason, retry := retryDelay(tt.err, tt.attempt, tt.resend)
+			if wait != tt.wantWait || reason != tt.wantReason || retry != tt.wantRetry {
+				t.Fatalf("retryDelay = %v, %q, %v, want %v, %q, %v", wait, reason, retry, tt.wantWait, tt.wantReason, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestBucketReserve(t *testing.T) {
+	start := time.Unix(0, 0)
+	bk := bucket{tokens: chatBurst, last: start}
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  time.Duration
+	}{
+		{"burst 1", 0, 0},
+		{"burst 2", 0, 0},
+		{"burst 3", 0, 0},
+		{"over burst waits for a token", 0, time.Second},
+		{"debt adds up", 0, 2 * time.Second},
+		{"refill pays the debt", 3 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bk.reserve(start.Add(tt.after), chatRate, chatBurst); got != tt.want {
+				t.Fatalf("reserve = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+const configPollInterval = 2 * time.Second
+
+// restartOnlyFields are read once at startup; reloads keep their old values.
+var restartOnlyFields = map[string]bool{
+	"api_token":        true,
+	"db_host":          true,
+	"db_port":          true,
+	"db_user":          true,
+	"db_password":      true,
+	"db_name":          true,
+	"db_sslmode":       true,
+	"default_language": true,
+	"locales_dir":      true,
+	"log_format":       true,
+	"http_addr":        true,
+}
+
+var secretFields = map[string]bool{
+	"api_token":      true,
+	"admin_password": true,
+	"link_secret":    true,
+	"db_password":    true,
+}
+
+func (cfg *Config) clone() *Config {
+	copied := *cfg
+	copied.SponsoredChannels = slices.Clone(cfg.SponsoredChannels)
+	copied.CaptionRules.AllowedMentions = slices.Clone(cfg.CaptionRules.AllowedMentions)
+	copied.CaptionRules.Replacements = slices.Clone(cfg.CaptionRules.Replacements)
+	return &copied
+}
+
+// ReloadConfig re-reads the config file and the settings stored in the
+// database and swaps them in. An invalid config is rejected and the running
+// one stays in place.
+func (b *Bot) ReloadConfig() error {
+	return b.reloadConfig("config reloaded", false)
+}
+
+func (b *Bot) reloadConfig(event string, quiet bool) error {
+	next, err := LoadConfig(b.configPath)
+	var shadowed []string
+	if err == nil {
+		var values map[string]string
+		if values, err = b.settings.All(); err == nil {
+			shadowed, err = next.applySettings(values)
+		}
+	}
+	if err != nil {
+		b.logger.Error(event+": rejected, keeping current config", "err", err)
+		return err
+	}
+	if len(shadowed) > 0 && !quiet {
+		b.logger.Warn("settings table overrides config", "settings", shadowed)
+	}
+
+	b.configMu.Lock()
+	current := b.config
+	changes := diffConfig(current, next)
+	next = keepRestartOnly(current, next)
+	b.config = next
+	b.configMu.Unlock()
+	b.logLevel.UnmarshalText([]byte(next.LogLevel))
+
+	if len(changes) == 0 {
+		if !quiet {
+			b.logger.Info(event + ": no changes")
+		}
+		return nil
+	}
+	b.logger.Info(event, "changes", changes)
+	return nil
+}
+
+// diffConfig describes every changed field by its yaml name, hiding secrets.
+func diffConfig(old, next *Config) []string {
+	var changes []string
+	oldValue, nextValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	configType := oldValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		if !configType.Field(i).IsExported() {
+			continue
+		}
+		name := yamlName(configType.Field(i))
+		before, after := formatValue(oldValue.Field(i)), formatValue(nextValue.Field(i))
+		if before == after {
+			continue
+		}
+		change := fmt.Sprintf("%s: %s -> %s", name, before, after)
+		if secretFields[name] {
+			change = name + ": changed"
+		}
+		if restartOnlyFields[name] {
+			change += " (ignored until restart)"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// formatValue renders scalars with %v and composites as JSON, which also
+// leaves out unexported state such as compiled regexps.
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		raw, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprintf("%v", v.Interface())
+		}
+		return string(raw)
+	default:
+		return fmt.Sprintf("%q", fmt.Sprint(v.Interface()))
+	}
+}
+
+func keepRestartOnly(old, next *Config) *Config {
+	oldValue, nextValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	configType := oldValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		if !configType.Field(i).IsExported() {
+			continue
+		}
+		if restartOnlyFields[yamlName(configType.Field(i))] {
+			nextValue.Field(i).Set(oldValue.Field(i))
+		}
+	}
+	return next
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// watchConfig reloads the config whenever the file's size or modification
+// time changes. Polling keeps it working on bind mounts and ConfigMaps.
+func (b *Bot) watchConfig(ctx context.Context) {
+	last, err := os.Stat(b.configPath)
+	if err != nil {
+		b.logger.Warn("config watch disabled", "err", err)
+		return
+	}
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(b.configPath)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			b.ReloadConfig()
+		}
+	}
+}
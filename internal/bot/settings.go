@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	settingsPollInterval = 5 * time.Second
+	historyLimit         = 15
+)
+
+// runtimeSettings are the config fields admins change from the chat. They
+// are stored in the settings table, whose values win over config.yaml, which
+// then only provides their initial values.
+var runtimeSettings = map[string]bool{
+	"default_tag":         true,
+	"delete_delay":        true,
+	"sponsored_channels":  true,
+	"show_preview":        true,
+	"caption_template":    true,
+	"caption_template_at": true,
+	"caption_rules":       true,
+}
+
+// applySettings overrides runtime fields with the YAML-encoded values stored
+// in the database. It returns the settings whose stored value replaced a
+// different one from config.yaml or the environment.
+func (cfg *Config) applySettings(values map[string]string) ([]string, error) {
+	value := reflect.ValueOf(cfg).Elem()
+	configType := value.Type()
+	var shadowed []string
+	for i := 0; i < configType.NumField(); i++ {
+		if !configType.Field(i).IsExported() {
+			continue
+		}
+		name := yamlName(configType.Field(i))
+		raw, ok := values[name]
+		if !ok || !runtimeSettings[name] {
+			continue
+		}
+		decoded := reflect.New(configType.Field(i).Type)
+		if err := yaml.Unmarshal([]byte(raw), decoded.Interface()); err != nil {
+			return nil, fmt.Errorf("setting %s: %w", name, err)
+		}
+		if !reflect.DeepEqual(value.Field(i).Interface(), decoded.Elem().Interface()) {
+			shadowed = append(shadowed, name)
+		}
+		value.Field(i).Set(decoded.Elem())
+	}
+	return shadowed, cfg.CaptionRules.compile()
+}
+
+// changedSettings encodes the runtime fields that differ between old and
+// next. Changing any other field is an error, since it would not survive a
+// restart.
+func changedSettings(old, next *Config) (map[string]string, error) {
+	values := make(map[string]string)
+	oldValue, nextValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	configType := oldValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		if !configType.Field(i).IsExported() {
+			continue
+		}
+		if formatValue(oldValue.Field(i)) == formatValue(nextValue.Field(i)) {
+			continue
+		}
+		name := yamlName(configType.Field(i))
+		if !runtimeSettings[name] {
+			return nil, fmt.Errorf("%s cannot be changed at runtime", name)
+		}
+		raw, err := yaml.Marshal(nextValue.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		values[name] = strings.TrimSuffix(string(raw), "\n")
+	}
+	return values, nil
+}
+
+// watchSettings picks up settings and texts changed by other replicas by
+// polling the counter in settings_version.
+func (b *Bot) watchSettings(ctx context.Context) {
+	last, err := b.settings.Version()
+	if err != nil {
+		b.logger.Warn("settings watch", "err", err)
+	}
+	ticker := time.NewTicker(settingsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			version, err := b.settings.Version()
+			if err != nil {
+				b.logger.Warn("settings watch", "err", err)
+				continue
+			}
+			if version == last {
+				continue
+			}
+			last = version
+			b.reloadConfig("settings changed", true)
+			if err := b.reloadTexts(); err != nil {
+				b.logger.Error("reload texts", "err", err)
+			}
+		}
+	}
+}
+
+func (b *Bot) handleSettings(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	cfg := b.getConfig()
+	channels := loc.Text("settings_none")
+	if len(cfg.SponsoredChannels) > 0 {
+		channels = strings.Join(cfg.SponsoredChannels, ", ")
+	}
+	preview := loc.Text("settings_off")
+	if cfg.ShowPreview {
+		preview = loc.Text("settings_on")
+	}
+	b.reply(message.Chat.ID, loc.Text("settings_summary", cfg.DefaultTag, cfg.DeleteDelay, preview, channels))
+}
+
+func (b *Bot) handleChannels(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	channels := b.getConfig().SponsoredChannels
+	if len(channels) == 0 {
+		b.reply(message.Chat.ID, loc.Text("channels_empty"))
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("channels_list", strings.Join(channels, "\n")))
+}
+
+// handleAddChannel adds a sponsored channel once the bot is confirmed to be
+// an admin there; otherwise membership checks for it would always fail.
+func (b *Bot) handleAddChannel(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 1 || normalizeChannel(args[0]) == "" {
+		b.reply(message.Chat.ID, loc.Text("addchannel_usage"))
+		return
+	}
+	channel := "@" + normalizeChannel(args[0])
+
+	status, err := b.chatMemberStatus(channel, b.api.Self.ID)
+	if err != nil {
+		b.logger.WarnContext(ctx, "check bot in channel", "channel", channel, "err", err)
+		b.reply(message.Chat.ID, loc.Text("addchannel_unreachable", channel))
+		return
+	}
+	if status != "administrator" && status != "creator" {
+		b.reply(message.Chat.ID, loc.Text("addchannel_not_admin", channel))
+		return
+	}
+
+	b.handleConfigUpdate(ctx, message, func(cfg *Config, _ []string) (string, bool, error) {
+		if channelIndex(cfg.SponsoredChannels, channel) >= 0 {
+			return loc.Text("addchannel_exists", channel), false, nil
+		}
+		cfg.SponsoredChannels = append(cfg.SponsoredChannels, channel)
+		return loc.Text("addchannel_done", channel), true, nil
+	})
+}
+
+func (b *Bot) handleRemoveChannel(ctx context.Context, message *tgbotapi.Message) {
+	loc := b.userLocale(message.From)
+	b.handleConfigUpdate(ctx, message, func(cfg *Config, args []string) (string, bool, error) {
+		if len(args) != 1 {
+			return loc.Text("removechannel_usage"), false, nil
+		}
+		i := channelIndex(cfg.SponsoredChannels, args[0])
+		if i < 0 {
+			return loc.Text("removechannel_unknown", args[0]), false, nil
+		}
+		removed := cfg.SponsoredChannels[i]
+		cfg.SponsoredChannels = append(cfg.SponsoredChannels[:i:i], cfg.SponsoredChannels[i+1:]...)
+		return loc.Text("removechannel_done", removed), true, nil
+	})
+}
+
+// handleSetDelay accepts plain seconds ("45") or a Go duration ("2m").
+func (b *Bot) handleSetDelay(ctx context.Context, message *tgbotapi.Message) {
+	loc := b.userLocale(message.From)
+	b.handleConfigUpdate(ctx, message, func(cfg *Config, args []string) (string, bool, error) {
+		if len(args) != 1 {
+			return loc.Text("setdelay_usage"), false, nil
+		}
+		seconds, err := strconv.Atoi(args[0])
+		if err != nil {
+			d, derr := time.ParseDuration(args[0])
+			if derr != nil {
+				return loc.Text("setdelay_usage"), false, nil
+			}
+			seconds = int(d / time.Second)
+		}
+		if seconds <= 0 {
+			return loc.Text("setdelay_usage"), false, nil
+		}
+		cfg.DeleteDelay = seconds
+		return loc.Text("setdelay_done", seconds), true, nil
+	})
+}
+
+func (b *Bot) handleSetPreview(ctx context.Context, message *tgbotapi.Message) {
+	loc := b.userLocale(message.From)
+	b.handleConfigUpdate(ctx, message, func(cfg *Config, args []string) (string, bool, error) {
+		if len(args) != 1 {
+			return loc.Text("setpreview_usage"), false, nil
+		}
+		switch strings.ToLower(args[0]) {
+		case "on":
+			cfg.ShowPreview = true
+		case "off":
+			cfg.ShowPreview = false
+		default:
+			return loc.Text("setpreview_usage"), false, nil
+		}
+		return loc.Text("setpreview_done", strings.ToLower(args[0])), true, nil
+	})
+}
+
+// handleHistory lists recent setting and text changes, optionally for one
+// key such as default_tag or text:fa:welcome.
+func (b *Bot) handleHistory(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	key := ""
+	if len(args) > 0 {
+		key = args[0]
+	}
+	changes, err := b.settings.History(key, historyLimit)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "load settings history", "err", err)
+		b.reply(message.Chat.ID, loc.Text("history_failed"))
+		return
+	}
+	if len(changes) == 0 {
+		b.reply(message.Chat.ID, loc.Text("history_empty"))
+		return
+	}
+	entries := make([]string, 0, len(changes))
+	for _, change := range changes {
+		entries = append(entries, loc.Text("history_entry",
+			change.ChangedAt.UTC().Format("2006-01-02 15:04"),
+			change.Key,
+			change.ChangedBy,
+			historyValue(change.OldValue),
+			historyValue(change.NewValue),
+		))
+	}
+	b.reply(message.Chat.ID, strings.Join(entries, "\n\n"))
+}
+
+func historyValue(value string) string {
+	const max = 80
+	if value == "" {
+		return "—"
+	}
+	if runes := []rune(value); len(runes) > max {
+		return string(runes[:max]) + "…"
+	}
+	return value
+}
+
+// channelIndex finds channel in channels, ignoring "@" and t.me prefixes.
+func channelIndex(channels []string, channel string) int {
+	target := strings.ToLower(normalizeChannel(channel))
+	for i, c := range channels {
+		if strings.ToLower(normalizeChannel(c)) == target {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aliebadimehr/telegram-uploader-bot/internal/link"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// startKey turns a /start payload into a file key. Signed payloads are
+// checked for expiry and recipient; plain keys are refused when
+// signed_links_only is set, except for admins.
+func (b *Bot) startKey(ctx context.Context, message *tgbotapi.Message, payload string) (string, bool) {
+	cfg := b.getConfig()
+	loc := b.userLocale(message.From)
+	if cfg.LinkSecret != "" {
+		if token, ok := link.NewSigner(cfg.LinkSecret).Verify(payload); ok {
+			ctx = withLogAttrs(ctx, "file_key", token.FileKey)
+			if !token.Expires.IsZero() && time.Now().After(token.Expires) {
+				b.logger.DebugContext(ctx, "expired signed link", "expired_at", token.Expires)
+				b.reply(message.Chat.ID, loc.Text("link_expired"))
+				deliveriesTotal.WithLabelValues("unknown", "expired").Inc()
+				return "", false
+			}
+			if token.UserID != 0 && token.UserID != message.From.ID {
+				b.logger.DebugContext(ctx, "signed link for another user", "link_user", token.UserID)
+				b.reply(message.Chat.ID, loc.Text("link_not_yours"))
+				deliveriesTotal.WithLabelValues("unknown", "rejected").Inc()
+				return "", false
+			}
+			return token.FileKey, true
+		}
+	}
+	if cfg.SignedLinksOnly && !b.isAdmin(message.From.ID) {
+		b.reply(message.Chat.ID, loc.Text("not_found"))
+		deliveriesTotal.WithLabelValues("unknown", "rejected").Inc()
+		b.recordLookup(ctx, message.From, false)
+		return "", false
+	}
+	return payload, true
+}
+
+// handleSignLink issues a signed link to a file, optionally expiring after a
+// duration and only valid for one user:
+// /signlink <key> [duration] [user_id|@username].
+func (b *Bot) handleSignLink(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	secret := b.getConfig().LinkSecret
+	if secret == "" {
+		b.reply(message.Chat.ID, loc.Text("signlink_disabled"))
+		return
+	}
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) < 1 || len(args) > 3 {
+		b.reply(message.Chat.ID, loc.Text("signlink_usage"))
+		return
+	}
+	token := link.Token{FileKey: args[0]}
+	ctx = withLogAttrs(ctx, "file_key", token.FileKey)
+	for _, arg := range args[1:] {
+		if d, err := time.ParseDuration(arg); err == nil && d > 0 && token.Expires.IsZero() {
+			token.Expires = time.Now().Add(d)
+			continue
+		}
+		if token.UserID != 0 {
+			b.reply(message.Chat.ID, loc.Text("signlink_usage"))
+			return
+		}
+		userID, ok := b.resolveUserID(ctx, message, arg)
+		if !ok {
+			return
+		}
+		token.UserID = userID
+	}
+
+	record, source, err := b.resolveKey(token.FileKey)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "fetch file", "err", err)
+		b.reply(message.Chat.ID, loc.Text("info_failed"))
+		return
+	}
+	if record == nil {
+		b.reply(message.Chat.ID, loc.Text("info_not_found"))
+		return
+	}
+	if source == nil {
+		token.FileKey = record.FileKey
+	}
+	payload, err := link.NewSigner(secret).Sign(token)
+	if errors.Is(err, link.ErrTooLong) {
+		b.reply(message.Chat.ID, loc.Text("signlink_too_long"))
+		return
+	}
+	if err != nil {
+		b.logger.ErrorContext(ctx, "sign link", "err", err)
+		b.reply(message.Chat.ID, loc.Text("info_failed"))
+		return
+	}
+
+	expires := loc.Text("signlink_never")
+	if !token.Expires.IsZero() {
+		expires = token.Expires.UTC().Format("2006-01-02 15:04 MST")
+	}
+	recipient := loc.Text("signlink_anyone")
+	if token.UserID != 0 {
+		recipient = strconv.FormatInt(token.UserID, 10)
+	}
+	b.reply(message.Chat.ID, loc.Text("signlink_done", b.fileLink(payload), expires, recipient))
+}
@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	templateAtUpload   = "upload"
+	templateAtDelivery = "delivery"
+
+	templateSave    = "tpl_save"
+	templateDiscard = "tpl_discard"
+)
+
+// renderTemplate fills the caption template for a record. The template is HTML
+// (formatting typed by the admin is kept); placeholder values are escaped.
+func renderTemplate(template string, record *repository.FileRecord, tag, link string) string {
+	caption := record.Caption
+	if record.ParseMode != tgbotapi.ModeHTML {
+		caption = html.EscapeString(caption)
+	}
+	title := record.Title
+	if title == "" {
+		title = record.FileName
+	}
+	var size, duration, date string
+	if record.FileSize > 0 {
+		size = formatSize(record.FileSize)
+	}
+	if record.Duration > 0 {
+		duration = formatDuration(record.Duration)
+	}
+	created := record.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	date = created.UTC().Format("2006-01-02")
+
+	return strings.NewReplacer(
+		"{caption}", caption,
+		"{tag}", html.EscapeString(tag),
+		"{title}", html.EscapeString(title),
+		"{size}", size,
+		"{duration}", duration,
+		"{link}", html.EscapeString(link),
+		"{date}", date,
+	).Replace(template)
+}
+
+func templatable(record *repository.FileRecord) bool {
+	switch record.FileType {
+	case "text", "sticker", "video_note":
+		return false
+	default:
+		return true
+	}
+}
+
+// applyTemplate returns a copy of record with the template applied to its
+// caption, or record itself when no template applies at the given stage.
+func (b *Bot) applyTemplate(record *repository.FileRecord, stage string) *repository.FileRecord {
+	cfg := b.getConfig()
+	if cfg.CaptionTemplate == "" || cfg.templateStage() != stage || !templatable(record) {
+		return record
+	}
+	rendered := *record
+	rendered.Caption = renderTemplate(cfg.CaptionTemplate, record, cfg.DefaultTag, b.fileLink(record.FileKey))
+	rendered.ParseMode = tgbotapi.ModeHTML
+	return &rendered
+}
+
+func (cfg *Config) templateStage() string {
+	if cfg.CaptionTemplateAt == templateAtUpload {
+		return templateAtUpload
+	}
+	return templateAtDelivery
+}
+
+func (b *Bot) handleTemplate(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	cfg := b.getConfig()
+	if cfg.CaptionTemplate == "" {
+		b.reply(message.Chat.ID, loc.Text("template_none")+"\n\n"+loc.Text("template_usage"))
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("template_current", cfg.templateStage(), cfg.CaptionTemplate))
+}
+
+// handleSetTemplate shows a preview of the new template and waits for the
+// admin to confirm it with the inline buttons before saving.
+func (b *Bot) handleSetTemplate(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	raw := strings.TrimSpace(message.CommandArguments())
+	if raw == "" {
+		b.reply(message.Chat.ID, loc.Text("template_usage"))
+		return
+	}
+	template := ""
+	if raw != "off" {
+		text, entities := sliceEntities(message.Text, message.Entities, len(message.Text)-len(strings.TrimLeft(message.CommandArguments(), " \t\n")))
+		template = entitiesToHTML(text, entities)
+	}
+
+	b.pendingMu.Lock()
+	b.templates[message.From.ID] = template
+	b.pendingMu.Unlock()
+
+	preview := loc.Text("template_remove_preview")
+	if template != "" {
+		sample := b.sampleRecord()
+		preview = loc.Text("template_preview", renderTemplate(template, sample, b.getConfig().DefaultTag, b.fileLink(sample.FileKey)))
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, preview)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_save"), templateSave),
+			tgbotapi.NewInlineKeyboardButtonData(loc.Text("button_discard"), templateDiscard),
+		),
+	)
+	if _, err := b.send(msg); err != nil {
+		b.logger.ErrorContext(ctx, "send template preview", "err", err)
+		b.reply(message.Chat.ID, loc.Text("template_invalid"))
+	}
+}
+
+func (b *Bot) handleTemplateChoice(ctx context.Context, cq *tgbotapi.CallbackQuery) {
+	if cq.From == nil || !b.isAdmin(cq.From.ID) {
+		return
+	}
+	b.pendingMu.Lock()
+	template, ok := b.templates[cq.From.ID]
+	delete(b.templates, cq.From.ID)
+	b.pendingMu.Unlock()
+
+	loc := b.userLocale(cq.From)
+	chatID := cq.Message.Chat.ID
+	if !ok {
+		b.editText(chatID, cq.Message.MessageID, loc.Text("template_nothing"))
+		return
+	}
+	if cq.Data == templateDiscard {
+		b.editText(chatID, cq.Message.MessageID, loc.Text("template_discarded"))
+		return
+	}
+	_, err := b.updateConfig(cq.From.ID, func(cfg *Config) (string, bool, error) {
+		cfg.CaptionTemplate = template
+		return "", true, nil
+	})
+	if err != nil {
+		b.logger.ErrorContext(ctx, "persist config", "err", err)
+		b.editText(chatID, cq.Message.MessageID, loc.Text("config_persist_failed"))
+		return
+	}
+	b.editText(chatID, cq.Message.MessageID, loc.Text("template_saved"))
+}
+
+// sampleRecord is the newest stored file, or made-up data when there is none,
+// so previews show realistic values.
+func (b *Bot) sampleRecord() *repository.FileRecord {
+	if record, err := b.fileRepo.Latest(); err == nil && record != nil {
+		return record
+	}
+	return &repository.FileRecord{
+		FileKey:   "sample",
+		FileType:  "video",
+		Caption:   html.EscapeString(b.getConfig().DefaultTag),
+		ParseMode: tgbotapi.ModeHTML,
+		Title:     "Sample video",
+		FileSize:  48 << 20,
+		Duration:  754,
+		CreatedAt: time.Now(),
+	}
+}
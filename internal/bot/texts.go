@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var formatVerbRe = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z]`)
+
+// reloadTexts rebuilds the active locales from the locale files plus the
+// admin edits stored in bot_texts.
+func (b *Bot) reloadTexts() error {
+	overrides, err := b.textRepo.List()
+	if err != nil {
+		return err
+	}
+	locales := b.baseTexts.withOverrides(overrides)
+	b.localesMu.Lock()
+	b.locales = locales
+	b.localesMu.Unlock()
+	return nil
+}
+
+func (b *Bot) handleTexts(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	target := loc
+	if len(args) > 0 {
+		if !b.getLocales().has(args[0]) {
+			b.reply(message.Chat.ID, loc.Text("lang_unknown", args[0], strings.Join(b.getLocales().languages(), ", ")))
+			return
+		}
+		target = b.getLocales().get(args[0])
+	}
+	base := b.baseTexts.get(target.Lang)
+	keys := target.keys()
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if target.Text(key) != base.Text(key) {
+			key += " *"
+		}
+		lines = append(lines, key)
+	}
+	b.reply(message.Chat.ID, loc.Text("texts_list", target.Lang, strings.Join(lines, "\n")))
+}
+
+func (b *Bot) handleShowText(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 2 {
+		b.reply(message.Chat.ID, loc.Text("text_usage"))
+		return
+	}
+	target, ok := b.textTarget(message.Chat.ID, loc, args[0], args[1])
+	if !ok {
+		return
+	}
+	b.reply(message.Chat.ID, loc.Text("text_current", target.Lang, args[1], target.Text(args[1])))
+}
+
+// handleSetText stores a new text for one language and key. Everything after
+// the key, line breaks included, becomes the text.
+func (b *Bot) handleSetText(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	raw := strings.TrimLeft(message.CommandArguments(), " \t")
+	fields := strings.Fields(raw)
+	if len(fields) < 3 {
+		b.reply(message.Chat.ID, loc.Text("settext_usage"))
+		return
+	}
+	lang, key := strings.ToLower(fields[0]), fields[1]
+	rest := strings.TrimLeft(raw[len(fields[0]):], " \t")
+	text := strings.TrimSpace(rest[len(key):])
+
+	target, ok := b.textTarget(message.Chat.ID, loc, lang, key)
+	if !ok {
+		return
+	}
+	if want := formatVerbs(b.baseTexts.get(target.Lang).Text(key)); !slices.Equal(formatVerbs(text), want) {
+		b.reply(message.Chat.ID, loc.Text("text_placeholders", len(want)))
+		return
+	}
+	if err := b.textRepo.Set(target.Lang, key, text, message.From.ID); err != nil {
+		b.logger.ErrorContext(ctx, "save text", "lang", target.Lang, "key", key, "err", err)
+		b.reply(message.Chat.ID, loc.Text("text_failed"))
+		return
+	}
+	if err := b.reloadTexts(); err != nil {
+		b.logger.ErrorContext(ctx, "reload texts", "err", err)
+	}
+	b.reply(message.Chat.ID, b.userLocale(message.From).Text("text_saved", key, target.Lang))
+}
+
+func (b *Bot) handleResetText(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 2 {
+		b.reply(message.Chat.ID, loc.Text("resettext_usage"))
+		return
+	}
+	target, ok := b.textTarget(message.Chat.ID, loc, args[0], args[1])
+	if !ok {
+		return
+	}
+	if err := b.textRepo.Delete(target.Lang, args[1], message.From.ID); err != nil {
+		b.logger.ErrorContext(ctx, "reset text", "lang", target.Lang, "key", args[1], "err", err)
+		b.reply(message.Chat.ID, loc.Text("text_failed"))
+		return
+	}
+	if err := b.reloadTexts(); err != nil {
+		b.logger.ErrorContext(ctx, "reload texts", "err", err)
+	}
+	b.reply(message.Chat.ID, b.userLocale(message.From).Text("text_reset", args[1], target.Lang))
+}
+
+// textTarget validates a language and key given by an admin, replying with
+// the problem when either is unknown.
+func (b *Bot) textTarget(chatID int64, loc Localization, lang, key string) (Localization, bool) {
+	locales := b.getLocales()
+	if !locales.has(lang) {
+		b.reply(chatID, loc.Text("lang_unknown", lang, strings.Join(locales.languages(), ", ")))
+		return Localization{}, false
+	}
+	target := locales.get(lang)
+	if _, ok := target.texts[key]; !ok {
+		b.reply(chatID, loc.Text("text_unknown_key", key))
+		return Localization{}, false
+	}
+	return target, true
+}
+
+// formatVerbs lists the fmt verbs in text so an edited text keeps the
+// arguments the code passes to it.
+func formatVerbs(text string) []string {
+	return formatVerbRe.FindAllString(strings.ReplaceAll(text, "%%", ""), -1)
+}
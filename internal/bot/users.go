@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+
+	repository "github.com/aliebadimehr/telegram-uploader-bot/internal/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// touchUser keeps the users registry current for whoever sent an update.
+func (b *Bot) touchUser(ctx context.Context, user *tgbotapi.User) {
+	if user == nil || user.IsBot {
+		return
+	}
+	err := b.userRepo.Touch(&repository.User{
+		ID:           user.ID,
+		Username:     user.UserName,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		LanguageCode: user.LanguageCode,
+	})
+	if err != nil {
+		b.logger.WarnContext(ctx, "touch user", "err", err)
+	}
+}
+
+// markBlocked records that the user behind a private chat blocked the bot.
+// Private chat IDs are the user's ID; groups and channels are negative.
+func (b *Bot) markBlocked(chatID int64) {
+	if chatID <= 0 {
+		return
+	}
+	if err := b.userRepo.MarkBlocked(chatID); err != nil {
+		b.logger.Warn("mark user blocked", "user_id", chatID, "err", err)
+	}
+}
+
+// chatIDOf returns the ChatID a request is addressed to, or 0 when it has
+// none. Most configs embed it through BaseChat, BaseFile or BaseEdit.
+func chatIDOf(c tgbotapi.Chattable) int64 {
+	value := reflect.Indirect(reflect.ValueOf(c))
+	if value.Kind() != reflect.Struct {
+		return 0
+	}
+	field := value.FieldByName("ChatID")
+	if !field.IsValid() || field.Kind() != reflect.Int64 {
+		return 0
+	}
+	return field.Int()
+}
+
+func (b *Bot) handleUser(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil || !b.isAdmin(message.From.ID) {
+		return
+	}
+	loc := b.userLocale(message.From)
+	args := b.parseArgs(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message.Chat.ID, loc.Text("user_usage"))
+		return
+	}
+	var user *repository.User
+	var err error
+	if id, parseErr := strconv.ParseInt(args[0], 10, 64); parseErr == nil {
+		user, err = b.userRepo.Get(id)
+	} else {
+		user, err = b.userRepo.FindByUsername(args[0])
+	}
+	if err != nil {
+		b.logger.ErrorContext(ctx, "look up user", "query", args[0], "err", err)
+		b.reply(message.Chat.ID, loc.Text("user_failed"))
+		return
+	}
+	if user == nil {
+		b.reply(message.Chat.ID, loc.Text("user_not_found"))
+		return
+	}
+	b.reply(message.Chat.ID, userInfo(user, loc))
+}
+
+// userInfo renders a registry entry for admins.
+func userInfo(user *repository.User, loc Localization) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	username := "—"
+	if user.Username != "" {
+		username = "@" + user.Username
+	}
+	status := loc.Text("user_active")
+	if user.BlockedBot {
+		status = loc.Text("user_blocked_bot")
+	}
+	return loc.Text("user_info",
+		user.ID,
+		name,
+		username,
+		user.LanguageCode,
+		user.FirstSeen.UTC().Format("2006-01-02 15:04 MST"),
+		user.LastSeen.UTC().Format("2006-01-02 15:04 MST"),
+		status,
+	)
+}
@@ -1,23 +1,42 @@
 package link
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"time"
 )
 
+// Link is a shareable URL to a file. Code is the start payload: the file key
+// for the link made at upload, a random code for tracked links, which carry a
+// Label naming where they were shared. Opens and Deliveries count the /start
+// requests made through the link and the files actually sent.
 type Link struct {
-	ID        int64
-	FileKey   string
-	URL       string
-	CreatedAt time.Time
+	ID         int64
+	FileKey    string
+	Code       string
+	Label      string
+	URL        string
+	Opens      int64
+	Deliveries int64
+	CreatedAt  time.Time
 }
 
+// DB is the part of *sql.DB the repository uses.
+type DB interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+const linkColumns = "id, file_key, code, label, url, opens, deliveries, created_at"
+
 type Repository struct {
-	db *sql.DB
+	db DB
 }
 
-func NewRepository(db *sql.DB) *Repository {
+func NewRepository(db DB) *Repository {
 	return &Repository{db: db}
 }
 
@@ -28,14 +47,70 @@ func (r *Repository) Save(linkRecord *Link) error {
 	if linkRecord == nil {
 		return errors.New("link record is nil")
 	}
+	if linkRecord.Code == "" {
+		return errors.New("link code is empty")
+	}
 	if linkRecord.CreatedAt.IsZero() {
 		linkRecord.CreatedAt = time.Now().UTC()
 	}
-	_, err := r.db.Exec(
-		"INSERT INTO links (file_key, url, created_at) VALUES ($1, $2, $3)",
+	return r.db.QueryRow(
+		"INSERT INTO links (file_key, code, label, url, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
 		linkRecord.FileKey,
+		linkRecord.Code,
+		linkRecord.Label,
 		linkRecord.URL,
 		linkRecord.CreatedAt,
+	).Scan(&linkRecord.ID)
+}
+
+// FindByCode returns the link with the given start payload, or nil.
+func (r *Repository) FindByCode(code string) (*Link, error) {
+	var l Link
+	err := r.db.QueryRow("SELECT "+linkColumns+" FROM links WHERE code = $1", code).Scan(
+		&l.ID, &l.FileKey, &l.Code, &l.Label, &l.URL, &l.Opens, &l.Deliveries, &l.CreatedAt,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ListByFile returns every link to a file, oldest first.
+func (r *Repository) ListByFile(fileKey string) ([]Link, error) {
+	rows, err := r.db.Query("SELECT "+linkColumns+" FROM links WHERE file_key = $1 ORDER BY id", fileKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []Link
+	for rows.Next() {
+		var l Link
+		if err := rows.Scan(&l.ID, &l.FileKey, &l.Code, &l.Label, &l.URL, &l.Opens, &l.Deliveries, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (r *Repository) CountOpen(id int64) error {
+	_, err := r.db.Exec("UPDATE links SET opens = opens + 1 WHERE id = $1", id)
+	return err
+}
+
+func (r *Repository) CountDelivery(id int64) error {
+	_, err := r.db.Exec("UPDATE links SET deliveries = deliveries + 1 WHERE id = $1", id)
 	return err
 }
+
+// NewCode returns a random start payload for a tracked link.
+func NewCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
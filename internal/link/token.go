@@ -0,0 +1,90 @@
+package link
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	tokenVersion = 1
+	macSize      = 10
+	// MaxPayload is the longest start parameter Telegram accepts.
+	MaxPayload = 64
+)
+
+var ErrTooLong = errors.New("signed link does not fit in a start parameter")
+
+// Token is what a signed start payload carries: a file key, optionally
+// limited to one user and to a point in time.
+type Token struct {
+	FileKey string
+	UserID  int64     // 0 means anyone
+	Expires time.Time // zero means never
+}
+
+// Signer issues and checks start payloads authenticated with HMAC-SHA256,
+// so personal or short-lived links need no database rows.
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Sign encodes the token as version, expiry and user as uvarints, the key,
+// and a truncated MAC over all of it, in unpadded URL-safe base64.
+func (s *Signer) Sign(token Token) (string, error) {
+	var expires uint64
+	if !token.Expires.IsZero() {
+		expires = uint64(token.Expires.Unix())
+	}
+	buf := []byte{tokenVersion}
+	buf = binary.AppendUvarint(buf, expires)
+	buf = binary.AppendUvarint(buf, uint64(token.UserID))
+	buf = append(buf, token.FileKey...)
+	buf = append(buf, s.mac(buf)...)
+	payload := base64.RawURLEncoding.EncodeToString(buf)
+	if len(payload) > MaxPayload {
+		return "", ErrTooLong
+	}
+	return payload, nil
+}
+
+// Verify decodes a payload made by Sign. ok is false for anything else,
+// including plain file keys; expiry and user are left to the caller.
+func (s *Signer) Verify(payload string) (Token, bool) {
+	buf, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(buf) < 1+macSize || buf[0] != tokenVersion {
+		return Token{}, false
+	}
+	body, sum := buf[:len(buf)-macSize], buf[len(buf)-macSize:]
+	if !hmac.Equal(sum, s.mac(body)) {
+		return Token{}, false
+	}
+	rest := body[1:]
+	expires, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return Token{}, false
+	}
+	rest = rest[n:]
+	userID, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return Token{}, false
+	}
+	token := Token{FileKey: string(rest[n:]), UserID: int64(userID)}
+	if expires != 0 {
+		token.Expires = time.Unix(int64(expires), 0)
+	}
+	return token, token.FileKey != ""
+}
+
+func (s *Signer) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write(data)
+	return h.Sum(nil)[:macSize]
+}
@@ -0,0 +1,85 @@
+package link
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	signer := NewSigner("secret")
+	expires := time.Unix(1893456000, 0)
+	tests := []struct {
+		name  string
+		token Token
+	}{
+		{"key only", Token{FileKey: "abc123"}},
+		{"with user", Token{FileKey: "abc123", UserID: 42}},
+		{"with expiry", Token{FileKey: "abc123", Expires: expires}},
+		{"with user and expiry", Token{FileKey: "abc-_9", UserID: 7000000000, Expires: expires}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := signer.Sign(tt.token)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if len(payload) > MaxPayload {
+				t.Fatalf("payload is %d bytes, want at most %d", len(payload), MaxPayload)
+			}
+			got, ok := signer.Verify(payload)
+			if !ok {
+				t.Fatalf("Verify(%q) failed", payload)
+			}
+			if got.FileKey != tt.token.FileKey || got.UserID != tt.token.UserID || !got.Expires.Equal(tt.token.Expires) {
+				t.Fatalf("Verify = %+v, want %+v", got, tt.token)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	signer := NewSigner("secret")
+	payload, err := signer.Sign(Token{FileKey: "abc123", UserID: 42})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := func(i int) string {
+		buf := append([]byte(nil), raw...)
+		buf[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(buf)
+	}
+	tests := []struct {
+		name    string
+		signer  *Signer
+		payload string
+	}{
+		{"plain key", signer, "abc123"},
+		{"empty", signer, ""},
+		{"tampered user", signer, tampered(2)},
+		{"tampered key", signer, tampered(len(raw) - macSize - 1)},
+		{"tampered mac", signer, tampered(len(raw) - 1)},
+		{"truncated", signer, base64.RawURLEncoding.EncodeToString(raw[:len(raw)-1])},
+		{"other secret", NewSigner("other"), payload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := tt.signer.Verify(tt.payload); ok {
+				t.Fatalf("Verify(%q) = %+v, want rejection", tt.payload, got)
+			}
+		})
+	}
+}
+
+func TestSignTooLong(t *testing.T) {
+	_, err := NewSigner("secret").Sign(Token{FileKey: strings.Repeat("k", MaxPayload)})
+	if !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Sign = %v, want ErrTooLong", err)
+	}
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Ban keeps a user from using the bot. BannedBy is 0 for automatic blocks and
+// a zero Until means the ban is permanent.
+type Ban struct {
+	UserID   int64
+	Reason   string
+	BannedBy int64
+	BannedAt time.Time
+	Until    time.Time
+}
+
+type BanRepository struct {
+	db DB
+}
+
+func NewBanRepository(db DB) *BanRepository {
+	return &BanRepository{db: db}
+}
+
+// Ban bans userID until the given time, replacing any earlier ban.
+func (r *BanRepository) Ban(ban Ban) error {
+	var until sql.NullTime
+	if !ban.Until.IsZero() {
+		until = sql.NullTime{Time: ban.Until.UTC(), Valid: true}
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO bans (user_id, reason, banned_by, banned_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET reason = EXCLUDED.reason,
+			banned_by = EXCLUDED.banned_by,
+			banned_at = EXCLUDED.banned_at,
+			expires_at = EXCLUDED.expires_at`,
+		ban.UserID, ban.Reason, ban.BannedBy, time.Now().UTC(), until,
+	)
+	return err
+}
+
+// Unban lifts the user's ban and reports whether one was in force.
+func (r *BanRepository) Unban(userID int64) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM bans WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > $2)", userID, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Active returns the user's ban if it has not expired, or nil.
+func (r *BanRepository) Active(userID int64) (*Ban, error) {
+	var ban Ban
+	var until sql.NullTime
+	err := r.db.QueryRow(`
+		SELECT user_id, reason, banned_by, banned_at, expires_at
+		FROM bans
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > $2)`,
+		userID, time.Now().UTC(),
+	).Scan(&ban.UserID, &ban.Reason, &ban.BannedBy, &ban.BannedAt, &until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ban.Until = until.Time
+	return &ban, nil
+}
@@ -0,0 +1,24 @@
+package repository
+
+import "database/sql"
+
+// Querier runs statements, inside a transaction or not.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Tx is the part of *sql.Tx the repositories use.
+type Tx interface {
+	Querier
+	Commit() error
+	Rollback() error
+}
+
+// DB is the part of *sql.DB the repositories use, so callers can pass a
+// wrapper that instruments queries, those in transactions included.
+type DB interface {
+	Querier
+	Begin() (Tx, error)
+}
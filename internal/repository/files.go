@@ -6,53 +6,162 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"time"
 )
 
 type FileRecord struct {
-	FileID   string
-	FileKey  string
-	Caption  string
-	FileType string
+	FileID       string
+	FileKey      string
+	Caption      string
+	FileType     string
+	Duration     int
+	Performer    string
+	Title        string
+	FileUniqueID string
+	FileName     string
+	MimeType     string
+	FileSize     int64
+	Width        int
+	Height       int
+	CreatedAt    time.Time
+	ParseMode    string // "HTML" when Caption holds rendered entities
+	PasswordHash string // salted hash of the code needed to open the link, if any
 }
 
+const fileColumns = "file_id, file_key, caption, file_type, duration, performer, title, " +
+	"file_unique_id, file_name, mime_type, file_size, width, height, created_at, parse_mode, password_hash"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFile(row rowScanner) (*FileRecord, error) {
+	record := &FileRecord{}
+	err := row.Scan(
+		&record.FileID,
+		&record.FileKey,
+		&record.Caption,
+		&record.FileType,
+		&record.Duration,
+		&record.Performer,
+		&record.Title,
+		&record.FileUniqueID,
+		&record.FileName,
+		&record.MimeType,
+		&record.FileSize,
+		&record.Width,
+		&record.Height,
+		&record.CreatedAt,
+		&record.ParseMode,
+		&record.PasswordHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ErrKeyTaken is returned when a chosen key already names a file or alias.
+var ErrKeyTaken = errors.New("file key already in use")
+
 type FileRepository struct {
-	db *sql.DB
+	db DB
 }
 
-func NewFileRepository(db *sql.DB) *FileRepository {
+func NewFileRepository(db DB) *FileRepository {
 	return &FileRepository{db: db}
 }
 
-func (r *FileRepository) Save(fileID, fileType, caption string) (string, error) {
-	fileKey, err := generateKey()
-	if err != nil {
+// Save stores the record under record.FileKey, or a freshly generated key
+// when that is empty, and returns the key.
+func (r *FileRepository) Save(record *FileRecord) (string, error) {
+	fileKey := record.FileKey
+	if fileKey == "" {
+		var err error
+		if fileKey, err = generateKey(); err != nil {
+			return "", err
+		}
+	} else if taken, err := r.KeyTaken(fileKey); err != nil {
 		return "", err
+	} else if taken {
+		return "", ErrKeyTaken
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
 	}
-	_, err = r.db.Exec(
-		"INSERT INTO files (file_id, file_key, caption, file_type) VALUES ($1, $2, $3, $4)",
-		fileID, fileKey, caption, fileType,
+	_, err := r.db.Exec(
+		"INSERT INTO files ("+fileColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)",
+		record.FileID, fileKey, record.Caption, record.FileType,
+		record.Duration, record.Performer, record.Title,
+		record.FileUniqueID, record.FileName, record.MimeType, record.FileSize,
+		record.Width, record.Height, record.CreatedAt, record.ParseMode, record.PasswordHash,
 	)
 	if err != nil {
 		return "", fmt.Errorf("save file: %w", err)
 	}
+	record.FileKey = fileKey
 	return fileKey, nil
 }
 
-func (r *FileRepository) UpdateCaption(fileKey, caption string) error {
+func (r *FileRepository) UpdateCaption(fileKey, caption, parseMode string) error {
 	_, err := r.db.Exec(
-		"UPDATE files SET caption = $1 WHERE file_key = $2",
-		caption, fileKey,
+		"UPDATE files SET caption = $1, parse_mode = $2 WHERE file_key = $3",
+		caption, parseMode, fileKey,
 	)
 	return err
 }
 
+// SetPassword stores the password hash for a file, or clears it when hash is
+// empty, and reports whether the file exists.
+func (r *FileRepository) SetPassword(fileKey, hash string) (bool, error) {
+	result, err := r.db.Exec("UPDATE files SET password_hash = $1 WHERE file_key = $2", hash, fileKey)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Get returns the file with the given key or alias, or nil.
 func (r *FileRepository) Get(fileKey string) (*FileRecord, error) {
 	row := r.db.QueryRow(
-		"SELECT file_id, caption, file_type FROM files WHERE file_key = $1",
+		"SELECT "+fileColumns+" FROM files WHERE file_key = $1 OR file_key = (SELECT file_key FROM file_aliases WHERE alias = $1) LIMIT 1",
 		fileKey,
 	)
-	record := &FileRecord{}
-	if err := row.Scan(&record.FileID, &record.Caption, &record.FileType); err != nil {
+	record, err := scanFile(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// Latest returns the most recently stored record, or nil when there are none.
+func (r *FileRepository) Latest() (*FileRecord, error) {
+	row := r.db.QueryRow("SELECT " + fileColumns + " FROM files ORDER BY id DESC LIMIT 1")
+	record, err := scanFile(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// FindByUniqueID returns the most recent record for a Telegram file_unique_id, or nil.
+func (r *FileRepository) FindByUniqueID(uniqueID string) (*FileRecord, error) {
+	if uniqueID == "" {
+		return nil, nil
+	}
+	row := r.db.QueryRow(
+		"SELECT "+fileColumns+" FROM files WHERE file_unique_id = $1 ORDER BY id DESC LIMIT 1",
+		uniqueID,
+	)
+	record, err := scanFile(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -61,6 +170,91 @@ func (r *FileRepository) Get(fileKey string) (*FileRecord, error) {
 	return record, nil
 }
 
+func (r *FileRepository) List() ([]FileRecord, error) {
+	rows, err := r.db.Query("SELECT " + fileColumns + " FROM files ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []FileRecord
+	for rows.Next() {
+		record, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	return records, rows.Err()
+}
+
+const keyTakenQuery = "SELECT EXISTS (SELECT 1 FROM files WHERE file_key = $1) " +
+	"OR EXISTS (SELECT 1 FROM file_aliases WHERE alias = $1) " +
+	"OR EXISTS (SELECT 1 FROM links WHERE code = $1)"
+
+// KeyTaken reports whether key names a file, an alias or a tracked link.
+func (r *FileRepository) KeyTaken(key string) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow(keyTakenQuery, key).Scan(&taken)
+	return taken, err
+}
+
+// Rename moves the file known by key or alias oldKey to newKey, carrying its
+// aliases, links and migration state along, and optionally keeps oldKey as
+// an alias so links already shared keep working. It reports whether the
+// file exists.
+func (r *FileRepository) Rename(oldKey, newKey string, keepAlias bool) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var current string
+	err = tx.QueryRow(
+		"SELECT file_key FROM files WHERE file_key = $1 OR file_key = (SELECT file_key FROM file_aliases WHERE alias = $1) FOR UPDATE",
+		oldKey,
+	).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var taken bool
+	err = tx.QueryRow(keyTakenQuery, newKey).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+	if taken {
+		return true, ErrKeyTaken
+	}
+	for _, query := range []string{
+		"UPDATE files SET file_key = $2 WHERE file_key = $1",
+		"UPDATE file_aliases SET file_key = $2 WHERE file_key = $1",
+		"UPDATE links SET file_key = $2 WHERE file_key = $1",
+		"UPDATE file_migrations SET file_key = $2 WHERE file_key = $1",
+	} {
+		if _, err := tx.Exec(query, current, newKey); err != nil {
+			return false, err
+		}
+	}
+	if keepAlias {
+		_, err = tx.Exec(
+			"INSERT INTO file_aliases (alias, file_key, created_at) VALUES ($1, $2, $3)",
+			current, newKey, time.Now().UTC(),
+		)
+	} else {
+		// the link made at upload uses the key itself as its code
+		_, err = tx.Exec(
+			"UPDATE links SET code = $2, url = replace(url, 'start=' || $1, 'start=' || $2) WHERE code = $1",
+			current, newKey,
+		)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
 func generateKey() (string, error) {
 	buf := make([]byte, 8)
 	if _, err := rand.Read(buf); err != nil {
@@ -0,0 +1,57 @@
+package repository
+
+import "time"
+
+type MigrationRepository struct {
+	db DB
+}
+
+func NewMigrationRepository(db DB) *MigrationRepository {
+	return &MigrationRepository{db: db}
+}
+
+// IsMigrated reports whether the file already received a file_id for the given bot.
+func (r *MigrationRepository) IsMigrated(fileKey string, botID int64) (bool, error) {
+	var done bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM file_migrations WHERE file_key = $1 AND bot_id = $2 AND error IS NULL)",
+		fileKey, botID,
+	).Scan(&done)
+	return done, err
+}
+
+// MarkMigrated stores the file_id the new bot obtained and records the
+// migration in one transaction, so an interrupted run never leaves a file
+// holding the new id without its migration mark.
+func (r *MigrationRepository) MarkMigrated(fileKey string, botID int64, fileID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE files SET file_id = $1 WHERE file_key = $2", fileID, fileKey); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO file_migrations (file_key, bot_id, file_id, error, updated_at)
+		VALUES ($1, $2, $3, NULL, $4)
+		ON CONFLICT (file_key, bot_id) DO UPDATE
+		SET file_id = EXCLUDED.file_id, error = NULL, updated_at = EXCLUDED.updated_at`,
+		fileKey, botID, fileID, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MigrationRepository) MarkFailed(fileKey string, botID int64, reason string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO file_migrations (file_key, bot_id, file_id, error, updated_at)
+		VALUES ($1, $2, NULL, $3, $4)
+		ON CONFLICT (file_key, bot_id) DO UPDATE
+		SET error = EXCLUDED.error, updated_at = EXCLUDED.updated_at`,
+		fileKey, botID, reason, time.Now().UTC(),
+	)
+	return err
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PreferenceRepository struct {
+	db DB
+}
+
+func NewPreferenceRepository(db DB) *PreferenceRepository {
+	return &PreferenceRepository{db: db}
+}
+
+// Language returns the language the user picked with /lang, or "" if none.
+func (r *PreferenceRepository) Language(userID int64) (string, error) {
+	var lang string
+	err := r.db.QueryRow("SELECT language FROM user_preferences WHERE user_id = $1", userID).Scan(&lang)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return lang, err
+}
+
+func (r *PreferenceRepository) SetLanguage(userID int64, lang string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO user_preferences (user_id, language, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET language = EXCLUDED.language, updated_at = EXCLUDED.updated_at`,
+		userID, lang, time.Now().UTC(),
+	)
+	return err
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SettingChange is one entry of settings_history. An empty OldValue means the
+// setting was unset before; an empty NewValue means it was reset.
+type SettingChange struct {
+	Key       string
+	OldValue  string
+	NewValue  string
+	ChangedBy int64
+	ChangedAt time.Time
+}
+
+// SettingsRepository stores runtime settings edited from the bot, keyed by
+// their config name, together with a history of every change.
+type SettingsRepository struct {
+	db DB
+}
+
+func NewSettingsRepository(db DB) *SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+func (r *SettingsRepository) All() (map[string]string, error) {
+	rows, err := r.db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// Set stores every value in values and records the changes in one
+// transaction.
+func (r *SettingsRepository) Set(values map[string]string, changedBy int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC()
+	for key, value := range values {
+		var old string
+		err := tx.QueryRow("SELECT value FROM settings WHERE key = $1 FOR UPDATE", key).Scan(&old)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO settings (key, value, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (key) DO UPDATE
+			SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at`,
+			key, value, changedBy, now,
+		)
+		if err != nil {
+			return err
+		}
+		if err := recordChange(tx, key, old, value, changedBy, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Version is a counter bumped in the transaction of every recorded change.
+// Replicas poll it to notice edits made elsewhere; unlike the history IDs it
+// only moves when a change commits, so none is missed.
+func (r *SettingsRepository) Version() (int64, error) {
+	var version int64
+	err := r.db.QueryRow("SELECT version FROM settings_version").Scan(&version)
+	return version, err
+}
+
+// History lists the most recent changes, newest first, optionally limited to
+// one key.
+func (r *SettingsRepository) History(key string, limit int) ([]SettingChange, error) {
+	rows, err := r.db.Query(`
+		SELECT key, old_value, new_value, changed_by, changed_at
+		FROM settings_history
+		WHERE $1 = '' OR key = $1
+		ORDER BY id DESC
+		LIMIT $2`,
+		key, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []SettingChange
+	for rows.Next() {
+		var change SettingChange
+		if err := rows.Scan(&change.Key, &change.OldValue, &change.NewValue, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func recordChange(tx Tx, key, old, value string, changedBy int64, at time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO settings_history (key, old_value, new_value, changed_by, changed_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		key, old, value, changedBy, at,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE settings_version SET version = version + 1")
+	return err
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// BotText is an admin override of one localized text.
+type BotText struct {
+	Lang string
+	Key  string
+	Text string
+}
+
+type TextRepository struct {
+	db DB
+}
+
+func NewTextRepository(db DB) *TextRepository {
+	return &TextRepository{db: db}
+}
+
+func (r *TextRepository) List() ([]BotText, error) {
+	rows, err := r.db.Query("SELECT lang, key, text FROM bot_texts ORDER BY lang, key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var texts []BotText
+	for rows.Next() {
+		var text BotText
+		if err := rows.Scan(&text.Lang, &text.Key, &text.Text); err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+	return texts, rows.Err()
+}
+
+// Set stores an edited text and records it in settings_history under
+// "text:<lang>:<key>", so the change shows up in the history and reaches
+// other replicas.
+func (r *TextRepository) Set(lang, key, text string, changedBy int64) error {
+	return r.change(lang, key, text, changedBy)
+}
+
+// Delete drops an edited text, restoring the locale default.
+func (r *TextRepository) Delete(lang, key string, changedBy int64) error {
+	return r.change(lang, key, "", changedBy)
+}
+
+func (r *TextRepository) change(lang, key, text string, changedBy int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var old string
+	err = tx.QueryRow("SELECT text FROM bot_texts WHERE lang = $1 AND key = $2 FOR UPDATE", lang, key).Scan(&old)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	now := time.Now().UTC()
+	if text == "" {
+		_, err = tx.Exec("DELETE FROM bot_texts WHERE lang = $1 AND key = $2", lang, key)
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO bot_texts (lang, key, text, updated_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (lang, key) DO UPDATE
+			SET text = EXCLUDED.text, updated_at = EXCLUDED.updated_at`,
+			lang, key, text, now,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if err := recordChange(tx, "text:"+lang+":"+key, old, text, changedBy, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
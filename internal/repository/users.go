@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// User is everyone who has sent the bot an update.
+type User struct {
+	ID           int64
+	Username     string
+	FirstName    string
+	LastName     string
+	LanguageCode string
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	BlockedBot   bool
+}
+
+const userColumns = "user_id, username, first_name, last_name, language_code, first_seen, last_seen, blocked_bot"
+
+type UserRepository struct {
+	db DB
+}
+
+func NewUserRepository(db DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// Touch records that user was just seen, refreshing their profile. A user who
+// writes to the bot has evidently unblocked it.
+func (r *UserRepository) Touch(user *User) error {
+	now := time.Now().UTC()
+	_, err := r.db.Exec(`
+		INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, FALSE)
+		ON CONFLICT (user_id) DO UPDATE
+		SET username = EXCLUDED.username,
+			first_name = EXCLUDED.first_name,
+			last_name = EXCLUDED.last_name,
+			language_code = EXCLUDED.language_code,
+			last_seen = EXCLUDED.last_seen,
+			blocked_bot = FALSE`,
+		user.ID, user.Username, user.FirstName, user.LastName, user.LanguageCode, now,
+	)
+	return err
+}
+
+// MarkBlocked flags a user whose chat answered 403, i.e. who blocked the bot.
+func (r *UserRepository) MarkBlocked(userID int64) error {
+	_, err := r.db.Exec("UPDATE users SET blocked_bot = TRUE WHERE user_id = $1", userID)
+	return err
+}
+
+// Get returns the user with the given ID, or nil if they never used the bot.
+func (r *UserRepository) Get(userID int64) (*User, error) {
+	return r.scanOne(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE user_id = $1", userID))
+}
+
+// FindByUsername looks a user up by @username, ignoring case.
+func (r *UserRepository) FindByUsername(username string) (*User, error) {
+	username = strings.TrimPrefix(username, "@")
+	return r.scanOne(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE lower(username) = lower($1) ORDER BY last_seen DESC LIMIT 1", username))
+}
+
+// Audience lists the users a broadcast should reach: everyone who has not
+// blocked the bot and is not banned, optionally limited to a language (their /lang choice, or
+// else their Telegram language) and to users seen since activeSince.
+func (r *UserRepository) Audience(lang string, activeSince time.Time) ([]int64, error) {
+	rows, err := r.db.Query(`
+		SELECT u.user_id
+		FROM users u
+		LEFT JOIN user_preferences p ON p.user_id = u.user_id
+		WHERE NOT u.blocked_bot
+			AND ($1 = '' OR lower(split_part(replace(COALESCE(NULLIF(p.language, ''), u.language_code), '_', '-'), '-', 1)) = $1)
+			AND u.last_seen >= $2
+			AND NOT EXISTS (
+				SELECT 1 FROM bans b
+				WHERE b.user_id = u.user_id AND (b.expires_at IS NULL OR b.expires_at > $3)
+			)
+		ORDER BY u.user_id`,
+		strings.ToLower(lang), activeSince, time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *UserRepository) scanOne(row *sql.Row) (*User, error) {
+	var user User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.FirstName,
+		&user.LastName,
+		&user.LanguageCode,
+		&user.FirstSeen,
+		&user.LastSeen,
+		&user.BlockedBot,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}